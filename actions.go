@@ -0,0 +1,93 @@
+package argo
+
+import (
+	"fmt"
+)
+
+// ActionFunc handles a custom action of a resource
+type ActionFunc func(*Request) (Response, *APIError)
+
+// Action is a custom endpoint of a resource. Item actions are routed after
+// the primary keys of the resource, such as POST /users/:id/restore, while
+// collection actions are routed after its name, such as POST /users/import.
+// Actions are also Modifiers, so they can be added to a ResourceSQL
+// directly; actions of a ResourceSQL with methods other than GET are run
+// in a transaction, see Request.Tx.
+type Action struct {
+	Method  string
+	Name    string
+	Item    bool
+	Handler ActionFunc
+}
+
+// Modify adds the action to the given resource
+func (action Action) Modify(resource *ResourceSQL) error {
+	if err := validateFieldName(action.Name); err != nil {
+		return err
+	}
+	for _, existing := range resource.actions {
+		if existing.Name == action.Name && existing.Item == action.Item && existing.Method == action.Method {
+			return fmt.Errorf(
+				"argo: the resource %s already has a %s action named '%s'",
+				resource.Name,
+				action.Method,
+				action.Name,
+			)
+		}
+	}
+	resource.actions = append(resource.actions, action)
+	return nil
+}
+
+// Actioner is implemented by resources with custom actions
+type Actioner interface {
+	Actions() []Action
+}
+
+// Actions returns the custom actions of the resource. Actions that may
+// write are wrapped in a transaction.
+func (c *ResourceSQL) Actions() []Action {
+	actions := make([]Action, len(c.actions))
+	for i, action := range c.actions {
+		if method(action.Method) != GET {
+			handler := action.Handler
+			action.Handler = func(r *Request) (Response, *APIError) {
+				return c.atomic(r, handler)
+			}
+		}
+		actions[i] = action
+	}
+	return actions
+}
+
+// actions routes the custom actions at a single path by method. It
+// implements Rest so that it can be stored in the routing tree.
+type actions map[method]ActionFunc
+
+func (a actions) serve(r *Request) (Response, *APIError) {
+	handler, exists := a[method(r.Method)]
+	if !exists {
+		return nil, unsupportedMethod(method(r.Method))
+	}
+	return handler(r)
+}
+
+func (a actions) List(r *Request) (Response, *APIError) {
+	return a.serve(r)
+}
+
+func (a actions) Post(r *Request) (Response, *APIError) {
+	return a.serve(r)
+}
+
+func (a actions) Get(r *Request) (Response, *APIError) {
+	return a.serve(r)
+}
+
+func (a actions) Patch(r *Request) (Response, *APIError) {
+	return a.serve(r)
+}
+
+func (a actions) Delete(r *Request) (Response, *APIError) {
+	return a.serve(r)
+}
@@ -23,7 +23,30 @@ type API struct {
 	prefix    string
 	resources map[string]Rest
 	routes    *node
+	actions   map[string]actions // Collection actions by path
 	conn      sql.Connection
+
+	authenticators []Authenticator
+	limiter        *RateLimiter
+
+	// Decoding of request bodies
+	maxBodySize int64
+	strict      bool
+
+	// Errors are written as problem details, see ProblemDetails
+	problems    bool
+	problemBase string
+
+	// Field errors are written with their codes, see StructuredErrors
+	structuredErrors bool
+
+	// Translations of error messages by locale, see Translate
+	bundles map[string]Bundle
+	locale  LocaleFunc
+
+	// Title and version of the OpenAPI document, see Info
+	title   string
+	version string
 }
 
 func (api *API) Prefix() string {
@@ -73,13 +96,102 @@ func (api *API) AddRest(name string, resource Rest, keys ...string) error {
 		api.routes.addRoute(fmt.Sprintf("%s%s/%s", p, name, pk), resource)
 		api.routes.addRoute(fmt.Sprintf("%s%s/%s/", p, name, pk), resource)
 	}
+
+	var list []Action
+	if actioner, ok := resource.(Actioner); ok {
+		list = actioner.Actions()
+	}
+	// JSON Schemas are served at the schema path, unless an action replaces it
+	if schemer, ok := resource.(JSONSchemer); ok && !hasSchemaAction(list) {
+		list = append(list, Action{
+			Method:  string(GET),
+			Name:    "schema",
+			Handler: schemer.JSONSchema,
+		})
+	}
+	return api.addActions(name, list, keys...)
+}
+
+// hasSchemaAction returns true if the actions replace the schema path
+func hasSchemaAction(list []Action) bool {
+	for _, action := range list {
+		if !action.Item && action.Name == "schema" && method(action.Method) == GET {
+			return true
+		}
+	}
+	return false
+}
+
+// addActions routes the custom actions of the named resource. Collection
+// actions are matched before the routing tree, since their paths would
+// conflict with the primary key parameters of the resource.
+func (api *API) addActions(name string, list []Action, keys ...string) error {
+	p := api.prefix
+	items := make(map[string]actions)
+	for _, action := range list {
+		if action.Item && len(keys) == 0 {
+			return fmt.Errorf(
+				"argo: the resource '%s' has no keys for its item action '%s'",
+				name,
+				action.Name,
+			)
+		}
+
+		var path string
+		var byMethod actions
+		if action.Item {
+			if byMethod = items[action.Name]; byMethod == nil {
+				byMethod = make(actions)
+				items[action.Name] = byMethod
+			}
+		} else {
+			path = fmt.Sprintf("%s%s/%s", p, name, action.Name)
+			if byMethod = api.actions[path]; byMethod == nil {
+				byMethod = make(actions)
+				api.actions[path] = byMethod
+				api.actions[path+"/"] = byMethod
+			}
+		}
+		if _, exists := byMethod[method(action.Method)]; exists {
+			return fmt.Errorf(
+				"argo: a %s action named '%s' already exists for the resource '%s'",
+				action.Method,
+				action.Name,
+				name,
+			)
+		}
+		byMethod[method(action.Method)] = action.Handler
+	}
+
+	for actionName, byMethod := range items {
+		pks := make([]string, len(keys))
+		for i, key := range keys {
+			pks[i] = fmt.Sprintf(":%s", key)
+		}
+		path := fmt.Sprintf(
+			"%s%s/%s/%s", p, name, strings.Join(pks, "/"), actionName,
+		)
+		api.routes.addRoute(path, byMethod)
+		api.routes.addRoute(path+"/", byMethod)
+	}
 	return nil
 }
 
+// unsupportedMethod is the error of requests whose method is not routed
+func unsupportedMethod(m method) *APIError {
+	return MessageError(
+		400, CodeUnsupportedMethod, map[string]interface{}{"method": m},
+	)
+}
+
 // Handle makes an API implement a handler with an argo Request instance
 func (api *API) Handle(w http.ResponseWriter, request *Request) {
 	// Publish the list of resources at root
 	if request.URL.Path == api.prefix {
+		if err := api.authenticate(request, nil); err != nil {
+			api.writeError(w, request, err)
+			return
+		}
 		// TODO alphabetical?
 		response := make(map[string]string)
 		for name, _ := range api.resources {
@@ -91,10 +203,31 @@ func (api *API) Handle(w http.ResponseWriter, request *Request) {
 		return
 	}
 
+	// Publish the OpenAPI document of the resources
+	if request.URL.Path == api.prefix+"openapi.json" {
+		if err := api.authenticate(request, nil); err != nil {
+			api.writeError(w, request, err)
+			return
+		}
+		w.Header().Set("Content-Type", JSON{}.MediaType())
+		w.Write(JSON{}.Encode(api.OpenAPI()))
+		return
+	}
+
 	// Parse the API parameters and build the request object
-	resource, params, _ := api.routes.getValue(request.URL.Path)
+	var resource Rest
+	var params Params
+	if collectionActions, exists := api.actions[request.URL.Path]; exists {
+		resource = collectionActions
+	} else {
+		resource, params, _ = api.routes.getValue(request.URL.Path)
+	}
 	if resource == nil {
-		http.NotFound(w, request.Request)
+		api.writeError(w, request, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": "path", "value": request.URL.Path},
+		))
 		return
 	}
 
@@ -105,20 +238,54 @@ func (api *API) Handle(w http.ResponseWriter, request *Request) {
 	var response Response
 	var err *APIError
 
+	// Actions are public and rate limited as their resource is
+	name := api.resourceName(request.URL.Path)
+
+	// JSON:API documents are typed by their resource
+	if encoding, ok := request.Encoding.(JSONAPI); ok {
+		request.Encoding = encoding.forResource(name, api.resources[name])
+	}
+	if decoding, ok := request.Decoding.(JSONAPI); ok {
+		request.Decoding = decoding.forResource(
+			name, api.resources[name],
+		).forParams(params)
+	}
+	// Clients are limited by their principal once authenticated, and by
+	// their address otherwise. Failed authentication is limited by address
+	// too, so that credentials cannot be guessed without limit.
+	authErr := api.authenticate(request, api.resources[name])
+	if api.limiter != nil {
+		if err = api.limiter.allow(request, name); err != nil {
+			api.writeError(w, request, err)
+			return
+		}
+	}
+	if authErr != nil {
+		api.writeError(w, request, authErr)
+		return
+	}
+	api.limitBody(request, api.resources[name])
+
 	// If there are no parameters
 	method := method(request.Method)
-	if len(params) == 0 {
+	if byMethod, ok := resource.(actions); ok {
+		response, err = byMethod.serve(request)
+	} else if len(params) == 0 {
 		switch method {
 		case GET:
 			response, err = resource.List(request)
 		case POST:
 			response, err = resource.Post(request)
+		case OPTIONS:
+			// Schemas depend on the principal, see JSONSchemer
+			schemer, ok := resource.(JSONSchemer)
+			if !ok {
+				err = unsupportedMethod(method)
+				break
+			}
+			response, err = schemer.JSONSchema(request)
 		default:
-			err = MetaError(
-				400,
-				"unsupported collection method: %s",
-				method,
-			)
+			err = unsupportedMethod(method)
 		}
 	} else {
 		switch method {
@@ -126,29 +293,72 @@ func (api *API) Handle(w http.ResponseWriter, request *Request) {
 			response, err = resource.Get(request)
 		case PATCH:
 			response, err = resource.Patch(request)
+		case PUT:
+			putter, ok := resource.(Putter)
+			if !ok {
+				err = unsupportedMethod(method)
+				break
+			}
+			response, err = putter.Put(request)
 		case DELETE:
 			response, err = resource.Delete(request)
 		default:
-			err = MetaError(
-				400,
-				"unsupported item method: %s",
-				method,
-			)
+			err = unsupportedMethod(method)
 		}
 	}
+
 	if err != nil {
-		err.Write(w, request.Encoding)
+		api.writeError(w, request, err)
 		return
 	}
+	// Copy any headers set by the resource
+	for key, values := range request.header {
+		w.Header()[key] = values
+	}
 	if response == nil {
 		w.WriteHeader(http.StatusNoContent) // 204
 		return
 	}
+	if _, ok := response.(NotModified); ok {
+		w.WriteHeader(http.StatusNotModified) // 304
+		return
+	}
+	if export, ok := response.(Export); ok {
+		w.Header().Set("Content-Type", request.Encoding.MediaType())
+		// Headers have been written, so errors can only end the stream
+		request.Encoding.(RowWriter).WriteRows(w, export.Fields, export.Rows)
+		return
+	}
+	if events, ok := response.(EventStream); ok {
+		writeEvents(w, request, events)
+		return
+	}
+	if stream, ok := response.(StreamResponse); ok {
+		api.writeStream(w, request, stream)
+		return
+	}
 	// Always set the media type
 	w.Header().Set("Content-Type", request.Encoding.MediaType())
 	w.Write(request.Encoding.Encode(response))
 }
 
+// writeError writes the error with any headers set for the request
+func (api *API) writeError(w http.ResponseWriter, request *Request, err *APIError) {
+	for key, values := range request.header {
+		w.Header()[key] = values
+	}
+	err.structured = api.structuredErrors
+	if bundle, locale := api.bundle(request); bundle != nil {
+		err.localize(bundle)
+		w.Header().Set("Content-Language", locale)
+	}
+	if api.problems || acceptsProblems(request.Request) {
+		err.WriteProblem(w, api.problemBase, request.URL.Path)
+		return
+	}
+	err.Write(w, request.Encoding)
+}
+
 // ServeHTTP implements the http Handler interface for APIs
 func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO request constructor function?
@@ -166,6 +376,10 @@ func New() *API {
 		prefix:    "/",
 		resources: make(map[string]Rest),
 		routes:    &node{},
+		actions:   make(map[string]actions),
+
+		maxBodySize: DefaultMaxBodySize,
+		bundles:     make(map[string]Bundle),
 	}
 }
 
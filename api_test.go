@@ -3,6 +3,7 @@ package argo
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,3 +66,54 @@ func TestAPI(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(http.StatusNoContent, resp.StatusCode)
 }
+
+type mockActions struct {
+	mockResource
+}
+
+func (m mockActions) Actions() []Action {
+	ok := func(*Request) (Response, *APIError) {
+		return map[string]string{"ok": "ok"}, nil
+	}
+	return []Action{
+		{Method: "POST", Name: "restore", Item: true, Handler: ok},
+		{Method: "POST", Name: "import", Handler: ok},
+		{Method: "GET", Name: "import", Handler: ok},
+	}
+}
+
+func TestAPI_Actions(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New()
+	assert.Nil(api.AddRest("things", mockActions{}, "id"))
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	// Item actions are routed after the keys
+	resp, err := http.Post(ts.URL+"/things/1/restore", "application/json", nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// Unsupported methods are rejected
+	resp, err = http.Get(ts.URL + "/things/1/restore")
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Collection actions take precedence over keys
+	resp, err = http.Post(ts.URL+"/things/import", "text/csv", strings.NewReader(""))
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/things/import")
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// Other items are routed as usual
+	resp, err = http.Get(ts.URL + "/things/1")
+	assert.Nil(err)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+
+	// Item actions require keys
+	assert.NotNil(api.AddRest("others", mockActions{}))
+}
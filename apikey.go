@@ -0,0 +1,154 @@
+package argo
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+)
+
+// CodeInvalidAPIKey is the message code of unknown API keys
+const CodeInvalidAPIKey = "invalid_api_key"
+
+var errInvalidAPIKey = Message(CodeInvalidAPIKey, nil)
+
+// APIKeyStore finds the principal of an API key. It should return a nil
+// principal and a nil error if the key does not exist.
+type APIKeyStore interface {
+	Principal(key string) (*Principal, error)
+}
+
+// APIKeys is a static APIKeyStore of principals by key
+type APIKeys map[string]*Principal
+
+// Principal implements the APIKeyStore interface. All keys are compared
+// in constant time.
+func (keys APIKeys) Principal(key string) (*Principal, error) {
+	var found *Principal
+	for k, principal := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = principal
+		}
+	}
+	return found, nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of the key, which is the
+// form stored in key tables, see KeysTable
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// KeyTable is an APIKeyStore backed by a database table. Keys are never
+// stored in the clear: the key column holds the output of HashAPIKey.
+type KeyTable struct {
+	conn  sql.Connection
+	table *sql.TableElem
+	key   sql.ColumnElem
+	id    sql.ColumnElem
+	roles *sql.ColumnElem
+}
+
+// Roles sets the column that holds the comma-separated roles of each key
+func (kt *KeyTable) Roles(name string) *KeyTable {
+	column := keyTableColumn(kt.table, name)
+	kt.roles = &column
+	return kt
+}
+
+// Principal implements the APIKeyStore interface
+func (kt *KeyTable) Principal(key string) (*Principal, error) {
+	columns := []sql.Selectable{kt.id}
+	if kt.roles != nil {
+		columns = append(columns, *kt.roles)
+	}
+	stmt := sql.Select(columns...).Where(kt.key.Equals(HashAPIKey(key)))
+
+	result := sql.Values{}
+	dbErr := kt.conn.QueryOne(stmt, result)
+	if dbErr == sql.ErrNoResult {
+		return nil, nil
+	} else if dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not select API key (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+
+	principal := &Principal{ID: fmt.Sprint(result[kt.id.Name()])}
+	if kt.roles != nil {
+		roles, _ := result[kt.roles.Name()].(string)
+		for _, role := range strings.Split(roles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+	return principal, nil
+}
+
+func keyTableColumn(table *sql.TableElem, name string) sql.ColumnElem {
+	column, exists := table.C[name]
+	if !exists {
+		panic(fmt.Sprintf(
+			"argo: cannot use '%s' for API keys, table '%s' does not have a column with this name",
+			name,
+			table.Name,
+		))
+	}
+	return column
+}
+
+// KeysTable creates an APIKeyStore that looks up hashed keys in the key
+// column of the given table. The id column is the ID of the principal.
+func KeysTable(conn sql.Connection, table *sql.TableElem, key, id string) *KeyTable {
+	return &KeyTable{
+		conn:  conn,
+		table: table,
+		key:   keyTableColumn(table, key),
+		id:    keyTableColumn(table, id),
+	}
+}
+
+// APIKeyAuthenticator authenticates requests with an API key header
+type APIKeyAuthenticator struct {
+	header string
+	store  APIKeyStore
+}
+
+// Header sets the request header of the key. It defaults to X-API-Key.
+func (auth *APIKeyAuthenticator) Header(name string) *APIKeyAuthenticator {
+	auth.header = name
+	return auth
+}
+
+// Challenge implements the Authenticator interface
+func (auth *APIKeyAuthenticator) Challenge() string {
+	return fmt.Sprintf(`APIKey header="%s"`, auth.header)
+}
+
+// Authenticate implements the Authenticator interface
+func (auth *APIKeyAuthenticator) Authenticate(r *Request) (*Principal, error) {
+	key := r.Header.Get(auth.header)
+	if key == "" {
+		return nil, nil
+	}
+	principal, err := auth.store.Principal(key)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, errInvalidAPIKey
+	}
+	return principal, nil
+}
+
+// APIKey creates an authenticator for the keys of the given store
+func APIKey(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{header: "X-API-Key", store: store}
+}
@@ -0,0 +1,115 @@
+package argo
+
+import (
+	"errors"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string
+	Roles  []string
+	Claims map[string]interface{}
+}
+
+// HasRole returns true if the principal has the given role
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the caller of a request. Authenticate should
+// return a nil principal and a nil error if the request does not carry
+// credentials of its kind, so that other authenticators can be tried, and
+// an error if the credentials are present but invalid.
+type Authenticator interface {
+	Authenticate(*Request) (*Principal, error)
+
+	// Challenge is the WWW-Authenticate value of unauthorized responses
+	Challenge() string
+}
+
+// Publicer is implemented by resources that may be requested without
+// credentials. Callers that do present credentials are still
+// authenticated, and invalid credentials are still rejected.
+type Publicer interface {
+	IsPublic() bool
+}
+
+// Public returns a Modifier that allows anonymous requests to the resource
+func Public() Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.public = true
+		return nil
+	})
+}
+
+// IsPublic implements the Publicer interface
+func (c *ResourceSQL) IsPublic() bool {
+	return c.public
+}
+
+// Authenticate sets the authenticators of the API. They are tried in order
+// and the first principal found is attached to the request. Once set,
+// every request must be authenticated unless its resource is public.
+func (api *API) Authenticate(authenticators ...Authenticator) *API {
+	api.authenticators = authenticators
+	return api
+}
+
+// authenticate attaches the principal of the request. It returns an error
+// if the credentials are invalid, or if they are missing and the resource
+// is not public.
+func (api *API) authenticate(request *Request, resource Rest) *APIError {
+	if len(api.authenticators) == 0 {
+		return nil
+	}
+	for _, authenticator := range api.authenticators {
+		principal, err := authenticator.Authenticate(request)
+		if err != nil {
+			request.ResponseHeader().Set(
+				"WWW-Authenticate", authenticator.Challenge(),
+			)
+			// Errors created by Message can be translated
+			apiErr := NewError(401)
+			var msg FieldError
+			if errors.As(err, &msg) {
+				apiErr.AddMetaError(msg)
+			} else {
+				apiErr.AddMeta("%s", err)
+			}
+			return apiErr
+		}
+		if principal != nil {
+			request.Principal = principal
+			return nil
+		}
+	}
+
+	if publicer, ok := resource.(Publicer); ok && publicer.IsPublic() {
+		return nil
+	}
+	for _, authenticator := range api.authenticators {
+		request.ResponseHeader().Add(
+			"WWW-Authenticate", authenticator.Challenge(),
+		)
+	}
+	return MessageError(401, CodeUnauthorized, nil)
+}
+
+// resourceName returns the name of the resource that the given path is
+// routed to, which is the first segment after the API prefix
+func (api *API) resourceName(path string) string {
+	path = strings.TrimPrefix(path, api.prefix)
+	if i := strings.Index(path, "/"); i != -1 {
+		path = path[:i]
+	}
+	return path
+}
@@ -0,0 +1,77 @@
+package argo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type publicResource struct {
+	mockResource
+}
+
+func (p publicResource) IsPublic() bool {
+	return true
+}
+
+func TestAPI_Authenticate(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{"abc": &Principal{ID: "1"}}
+	api := New().Authenticate(APIKey(keys))
+	api.AddRest("things", mockResource{}, "id")
+	api.AddRest("news", publicResource{}, "id")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	get := func(path, key string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(err)
+		return resp
+	}
+
+	// Anonymous requests are rejected with a challenge
+	resp := get("/things", "")
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(`APIKey header="X-API-Key"`, resp.Header.Get("WWW-Authenticate"))
+
+	resp = get("/", "")
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	resp = get("/things/1", "abc")
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+
+	resp = get("/things/1", "xyz")
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	// Public resources allow anonymous requests, but not invalid keys
+	resp = get("/news/1", "")
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+
+	resp = get("/news/1", "xyz")
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAPIKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{"abc": &Principal{ID: "1"}}
+	principal, err := keys.Principal("abc")
+	assert.Nil(err)
+	assert.Equal("1", principal.ID)
+
+	principal, err = keys.Principal("ab")
+	assert.Nil(err)
+	assert.Nil(principal)
+
+	assert.Equal(
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		HashAPIKey("abc"),
+	)
+}
@@ -0,0 +1,316 @@
+package argo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	sql "github.com/aodin/aspect"
+)
+
+// Policy decides whether the principal of a request, which is nil for
+// anonymous requests, may perform it. Keys are the URL parameters of item
+// requests, and values are the decoded values of writes, otherwise nil.
+type Policy func(principal *Principal, keys Params, values sql.Values) bool
+
+// AllowAuthenticated allows any authenticated principal
+func AllowAuthenticated() Policy {
+	return func(principal *Principal, keys Params, values sql.Values) bool {
+		return principal != nil
+	}
+}
+
+// AllowRoles allows principals with any of the given roles
+func AllowRoles(roles ...string) Policy {
+	return func(principal *Principal, keys Params, values sql.Values) bool {
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllowOwner allows principals whose ID is the value of the given key,
+// such as users requesting their own row
+func AllowOwner(key string) Policy {
+	return func(principal *Principal, keys Params, values sql.Values) bool {
+		return principal != nil && principal.ID != "" &&
+			principal.ID == keys.ByName(key)
+	}
+}
+
+// AnyOf allows the request if any of the given policies allow it
+func AnyOf(policies ...Policy) Policy {
+	return func(principal *Principal, keys Params, values sql.Values) bool {
+		for _, policy := range policies {
+			if policy(principal, keys, values) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// allowed returns true if every policy allows the request
+func allowed(policies []Policy, r *Request, values sql.Values) bool {
+	for _, policy := range policies {
+		if !policy(r.Principal, r.Params, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize returns a Modifier that requires every given policy to allow
+// requests of the method. GET policies cover both List and Get, and PATCH
+// policies also cover PUT, since both update existing entries.
+func Authorize(m method, policies ...Policy) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		switch m {
+		case GET, POST, PATCH, PUT, DELETE:
+		default:
+			return fmt.Errorf(
+				"argo: cannot authorize the unsupported method %s",
+				m,
+			)
+		}
+		resource.policies[m] = append(resource.policies[m], policies...)
+		return nil
+	})
+}
+
+// ReadableBy returns a Modifier that removes the given fields from the
+// responses of requests that the policy does not allow. Such requests
+// cannot filter or order by the fields either.
+func ReadableBy(policy Policy, names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			if !resource.selects.Has(name) {
+				return fmt.Errorf(
+					"argo: cannot restrict reads of '%s', it is not a selected field of '%s'",
+					name,
+					resource.Name,
+				)
+			}
+			resource.readPolicies[name] = append(
+				resource.readPolicies[name], policy,
+			)
+		}
+		return nil
+	})
+}
+
+// WritableBy returns a Modifier that rejects writes of the given fields by
+// requests that the policy does not allow.
+func WritableBy(policy Policy, names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			if !resource.inserts.Has(name) {
+				return fmt.Errorf(
+					"argo: cannot restrict writes of '%s', it is not a writable field of '%s'",
+					name,
+					resource.Name,
+				)
+			}
+			resource.writePolicies[name] = append(
+				resource.writePolicies[name], policy,
+			)
+		}
+		return nil
+	})
+}
+
+// policiesOf returns the policies that cover requests of the method
+func policiesOf(policies map[method][]Policy, m method) []Policy {
+	if m == PUT {
+		covered := make([]Policy, 0, len(policies[PATCH])+len(policies[PUT]))
+		covered = append(covered, policies[PATCH]...)
+		return append(covered, policies[PUT]...)
+	}
+	return policies[m]
+}
+
+// authorize checks the policies of the method
+func (c *ResourceSQL) authorize(r *Request, m method, values sql.Values) *APIError {
+	if !allowed(policiesOf(c.policies, m), r, values) {
+		return MessageError(403, CodeForbidden, nil)
+	}
+	return nil
+}
+
+// readable returns the selected columns that the request may read
+func (c *ResourceSQL) readable(r *Request) Columns {
+	if len(c.readPolicies) == 0 {
+		return c.selects
+	}
+	selects := Columns{}
+	for name, column := range c.selects {
+		if allowed(c.readPolicies[name], r, nil) {
+			selects[name] = column
+		}
+	}
+	return selects
+}
+
+// checkWritable confirms that the request may write all the given values
+func (c *ResourceSQL) checkWritable(r *Request, values sql.Values) *APIError {
+	err := NewError(403)
+	for name := range values {
+		if !allowed(c.writePolicies[name], r, values) {
+			err.AddField(name, Message(CodeNotWritable, nil))
+		}
+	}
+	if err.Exists() {
+		return err
+	}
+	return nil
+}
+
+// Guarded wraps a Rest resource with authorization policies, so they can
+// be used with AddRest. Custom actions of the resource are not guarded.
+type Guarded struct {
+	resource Rest
+	policies map[method][]Policy
+}
+
+// Allow requires every given policy to allow requests of the method. GET
+// policies cover both List and Get, and PATCH policies also cover PUT.
+func (g *Guarded) Allow(m method, policies ...Policy) *Guarded {
+	g.policies[m] = append(g.policies[m], policies...)
+	return g
+}
+
+// check consults the policies of the method. The values of writes are
+// decoded for the policies and the body is restored for the resource.
+func (g *Guarded) check(r *Request, m method, write bool) *APIError {
+	var values sql.Values
+	policies := policiesOf(g.policies, m)
+	if write && len(policies) > 0 {
+		body, err := ioutil.ReadAll(r.Body)
+		if r.bodyTooLarge() {
+			return MessageError(413, CodeBodyTooLarge, nil)
+		} else if err != nil {
+			return unreadableBody(err)
+		}
+		r.Body = ClosingBuffer{bytes.NewBuffer(body)}
+
+		var apiErr *APIError
+		if values, apiErr = r.Decode(bytes.NewReader(body)); apiErr != nil {
+			return apiErr
+		}
+	}
+	if !allowed(policies, r, values) {
+		return MessageError(403, CodeForbidden, nil)
+	}
+	return nil
+}
+
+func (g *Guarded) List(r *Request) (Response, *APIError) {
+	if apiErr := g.check(r, GET, false); apiErr != nil {
+		return nil, apiErr
+	}
+	return g.resource.List(r)
+}
+
+func (g *Guarded) Post(r *Request) (Response, *APIError) {
+	if apiErr := g.check(r, POST, true); apiErr != nil {
+		return nil, apiErr
+	}
+	return g.resource.Post(r)
+}
+
+func (g *Guarded) Get(r *Request) (Response, *APIError) {
+	if apiErr := g.check(r, GET, false); apiErr != nil {
+		return nil, apiErr
+	}
+	return g.resource.Get(r)
+}
+
+func (g *Guarded) Patch(r *Request) (Response, *APIError) {
+	if apiErr := g.check(r, PATCH, true); apiErr != nil {
+		return nil, apiErr
+	}
+	return g.resource.Patch(r)
+}
+
+// Put implements the Putter interface if the guarded resource does
+func (g *Guarded) Put(r *Request) (Response, *APIError) {
+	putter, ok := g.resource.(Putter)
+	if !ok {
+		return nil, unsupportedMethod(PUT)
+	}
+	if apiErr := g.check(r, PUT, true); apiErr != nil {
+		return nil, apiErr
+	}
+	return putter.Put(r)
+}
+
+func (g *Guarded) Delete(r *Request) (Response, *APIError) {
+	if apiErr := g.check(r, DELETE, false); apiErr != nil {
+		return nil, apiErr
+	}
+	return g.resource.Delete(r)
+}
+
+// IsPublic implements the Publicer interface if the guarded resource does
+func (g *Guarded) IsPublic() bool {
+	publicer, ok := g.resource.(Publicer)
+	return ok && publicer.IsPublic()
+}
+
+// MaxBodySize implements the BodyLimiter interface if the guarded
+// resource does
+func (g *Guarded) MaxBodySize() int64 {
+	if limiter, ok := g.resource.(BodyLimiter); ok {
+		return limiter.MaxBodySize()
+	}
+	return 0
+}
+
+// Actions implements the Actioner interface if the guarded resource does
+func (g *Guarded) Actions() []Action {
+	if actioner, ok := g.resource.(Actioner); ok {
+		return actioner.Actions()
+	}
+	return nil
+}
+
+// OpenAPI implements the OpenAPIer interface. The guarded resource is
+// described if it implements the interface; otherwise the fragment is
+// empty.
+func (g *Guarded) OpenAPI(name string) OpenAPIFragment {
+	if describer, ok := g.resource.(OpenAPIer); ok {
+		return describer.OpenAPI(name)
+	}
+	return OpenAPIFragment{}
+}
+
+// JSONSchema implements the JSONSchemer interface if the guarded resource
+// does. The schema may be read by requests that the GET policies allow.
+func (g *Guarded) JSONSchema(r *Request) (Response, *APIError) {
+	schemer, ok := g.resource.(JSONSchemer)
+	if !ok {
+		if method(r.Method) == OPTIONS {
+			return nil, unsupportedMethod(OPTIONS)
+		}
+		return nil, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": "path", "value": r.URL.Path},
+		)
+	}
+	if apiErr := g.check(r, GET, false); apiErr != nil {
+		return nil, apiErr
+	}
+	return schemer.JSONSchema(r)
+}
+
+// Guard wraps the resource so that authorization policies can be added
+func Guard(resource Rest) *Guarded {
+	return &Guarded{
+		resource: resource,
+		policies: make(map[method][]Policy),
+	}
+}
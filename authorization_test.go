@@ -0,0 +1,192 @@
+package argo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	admin := &Principal{ID: "1", Roles: []string{"admin"}}
+	user := &Principal{ID: "2"}
+	keys := Params{{Key: "id", Value: "2"}}
+
+	assert.True(AllowAuthenticated()(user, nil, nil))
+	assert.False(AllowAuthenticated()(nil, nil, nil))
+
+	assert.True(AllowRoles("admin", "hr")(admin, nil, nil))
+	assert.False(AllowRoles("admin")(user, nil, nil))
+	assert.False(AllowRoles("admin")(nil, nil, nil))
+
+	assert.True(AllowOwner("id")(user, keys, nil))
+	assert.False(AllowOwner("id")(admin, keys, nil))
+	assert.False(AllowOwner("id")(nil, keys, nil))
+
+	either := AnyOf(AllowRoles("admin"), AllowOwner("id"))
+	assert.True(either(admin, keys, nil))
+	assert.True(either(user, keys, nil))
+	assert.False(either(&Principal{ID: "3"}, keys, nil))
+}
+
+func TestGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{
+		"admin": &Principal{ID: "1", Roles: []string{"admin"}},
+		"user":  &Principal{ID: "2"},
+	}
+	noAdmins := func(principal *Principal, keys Params, values sql.Values) bool {
+		return values["role"] != "admin"
+	}
+	api := New().Authenticate(APIKey(keys))
+	api.AddRest(
+		"things",
+		Guard(mockResource{}).Allow(DELETE, AllowRoles("admin")).Allow(
+			PATCH, AnyOf(AllowRoles("admin"), AllowOwner("id")), noAdmins,
+		),
+		"id",
+	)
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	do := func(method, path, key, body string) int {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(http.StatusForbidden, do("DELETE", "/things/1", "user", ""))
+	assert.Equal(http.StatusNoContent, do("DELETE", "/things/1", "admin", ""))
+	assert.Equal(http.StatusNoContent, do("GET", "/things/1", "user", ""))
+
+	assert.Equal(http.StatusForbidden, do("PATCH", "/things/1", "user", `{}`))
+	assert.Equal(http.StatusNoContent, do("PATCH", "/things/2", "user", `{}`))
+	assert.Equal(
+		http.StatusForbidden,
+		do("PATCH", "/things/2", "user", `{"role":"admin"}`),
+	)
+
+	// The guarded resource does not support PUT
+	assert.Equal(http.StatusBadRequest, do("PUT", "/things/2", "admin", `{}`))
+}
+
+func TestPoliciesOf(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(
+		FromTable(usersDB),
+		Authorize(PATCH, AllowOwner("id")),
+		Authorize(PUT, AllowRoles("admin")),
+	)
+	r := MockRequest(nil, nil, 1)
+	r.Principal = &Principal{ID: "2", Roles: []string{"admin"}}
+	assert.NotNil(users.authorize(r, PUT, nil))
+	assert.Nil(users.authorize(r, POST, nil))
+
+	r.Principal = &Principal{ID: "1"}
+	assert.Nil(users.authorize(r, PATCH, nil))
+	assert.NotNil(users.authorize(r, PUT, nil))
+
+	r.Principal = &Principal{ID: "1", Roles: []string{"admin"}}
+	assert.Nil(users.authorize(r, PUT, nil))
+}
+
+func TestResource_Authorize(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB, notesDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	hr := AllowRoles("hr")
+	users := Resource(
+		FromTable(usersDB),
+		Authorize(DELETE, AllowRoles("admin")),
+		Authorize(PATCH, AnyOf(AllowRoles("admin"), AllowOwner("id"))),
+		ReadableBy(hr, "age"),
+		WritableBy(hr, "is_active"),
+	)
+	users.conn = tx
+
+	admin := &Principal{ID: "0", Roles: []string{"admin", "hr"}}
+	as := func(principal *Principal, r *Request) *Request {
+		r.Principal = principal
+		return r
+	}
+
+	response, errAPI := users.Post(as(admin, MockRequest(
+		[]byte(`{"name":"admin","age":40,"password":"secret","is_active":true}`),
+		nil,
+	)))
+	require.Nil(t, errAPI)
+	assert.Equal(int64(40), response.(sql.Values)["age"])
+	id := response.(sql.Values)["id"].(int64)
+
+	user := &Principal{ID: "user"}
+	response, errAPI = users.Post(as(user, MockRequest(
+		[]byte(`{"name":"user","age":20,"password":"secret"}`),
+		nil,
+	)))
+	require.Nil(t, errAPI)
+
+	// Fields that cannot be read are masked
+	_, masked := response.(sql.Values)["age"]
+	assert.False(masked)
+
+	// Fields that cannot be written are rejected
+	_, errAPI = users.Post(as(user, MockRequest(
+		[]byte(`{"name":"other","age":20,"password":"secret","is_active":false}`),
+		nil,
+	)))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+	assert.NotNil(errAPI.Fields["is_active"])
+
+	// Users cannot modify or delete others
+	_, errAPI = users.Patch(as(user, MockRequest([]byte(`{"name":"x"}`), nil, id)))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	// PATCH policies also cover PUT
+	_, errAPI = users.Put(as(user, MockRequest(
+		[]byte(`{"name":"x","age":1,"password":"secret"}`), nil, id,
+	)))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	_, errAPI = users.Delete(as(user, MockRequest(nil, nil, id)))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	_, errAPI = users.Delete(as(admin, MockRequest(nil, nil, id)))
+	assert.Nil(errAPI)
+
+	// Restores of soft deleted entries require the DELETE policies
+	notes := Resource(
+		FromTable(notesDB),
+		SoftDelete("deleted_at"),
+		Authorize(DELETE, AllowRoles("admin")),
+	)
+	notes.conn = tx
+	response, errAPI = notes.Post(as(admin, MockRequest([]byte(`{"text":"a"}`), nil)))
+	require.Nil(t, errAPI)
+	noteID := response.(sql.Values)["id"].(int64)
+	_, errAPI = notes.Delete(as(admin, MockRequest(nil, nil, noteID)))
+	require.Nil(t, errAPI)
+
+	restore := notes.Actions()[0].Handler
+	_, errAPI = restore(as(user, MockRequest(nil, nil, noteID)))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	_, errAPI = restore(as(admin, MockRequest(nil, nil, noteID)))
+	assert.Nil(errAPI)
+}
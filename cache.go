@@ -0,0 +1,92 @@
+package argo
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	sql "github.com/aodin/aspect"
+)
+
+// LastModified returns a Modifier that sets the Last-Modified header of
+// GET responses from the given timestamp column, such as updated_at.
+// List responses use the latest timestamp of their results. The column
+// must be selected.
+func LastModified(name string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		column, exists := resource.selects[name]
+		if !exists {
+			return fmt.Errorf(
+				"argo: cannot use '%s' as a last modified column, it is not a selected field of '%s'",
+				name,
+				resource.Name,
+			)
+		}
+		if _, ok := column.Type().(sql.Timestamp); !ok {
+			return fmt.Errorf(
+				"argo: cannot use '%s' as a last modified column, it is not a timestamp",
+				name,
+			)
+		}
+		resource.lastModified = name
+		return nil
+	})
+}
+
+// CacheControl returns a Modifier that sets the Cache-Control header of
+// GET responses, for example "private, max-age=5".
+func CacheControl(value string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.cacheControl = value
+		return nil
+	})
+}
+
+// modified returns the latest last modified timestamp of the given results.
+// It returns the zero time if no last modified column has been set.
+func (c *ResourceSQL) modified(results ...sql.Values) (latest time.Time) {
+	if c.lastModified == "" {
+		return
+	}
+	for _, result := range results {
+		if t, ok := result[c.lastModified].(time.Time); ok && t.After(latest) {
+			latest = t
+		}
+	}
+	return
+}
+
+// setCacheHeaders sets the caching headers of a GET response and reports
+// whether the client's copy, as given by the conditional headers of the
+// request, is still current. The entity tag is of the representation in
+// the encoding of the request.
+func (c *ResourceSQL) setCacheHeaders(r *Request, etag string, modified time.Time) bool {
+	etag = setETag(r, etag)
+	header := r.ResponseHeader()
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if c.cacheControl != "" {
+		header.Set("Cache-Control", c.cacheControl)
+	}
+	return notModified(r, etag, modified)
+}
+
+// notModified reports whether the conditional headers of the request match
+// the given entity tag and modification time. If-None-Match takes
+// precedence over If-Modified-Since.
+func notModified(r *Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return matchETag(header, etag, true)
+	}
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" || modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a resolution of seconds
+	return !modified.Truncate(time.Second).After(since)
+}
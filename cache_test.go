@@ -0,0 +1,108 @@
+package argo
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotModified(t *testing.T) {
+	assert := assert.New(t)
+
+	modified := time.Date(2015, 1, 1, 12, 0, 0, 500, time.UTC)
+	request := func(key, value string) *Request {
+		r := MockRequest(nil, nil)
+		r.Header = http.Header{key: []string{value}}
+		return r
+	}
+
+	assert.Equal(false, notModified(MockRequest(nil, nil), `"a"`, modified))
+
+	assert.Equal(true, notModified(request("If-None-Match", `W/"a"`), `"a"`, modified))
+	assert.Equal(false, notModified(request("If-None-Match", `"b"`), `"a"`, modified))
+
+	since := modified.Format(http.TimeFormat)
+	assert.Equal(true, notModified(request("If-Modified-Since", since), `"a"`, modified))
+	assert.Equal(false, notModified(request("If-Modified-Since", since), `"a"`, modified.Add(time.Second)))
+
+	// Without a last modified column, If-Modified-Since is ignored
+	assert.Equal(false, notModified(request("If-Modified-Since", since), `"a"`, time.Time{}))
+}
+
+func TestResourceSQL_Modified(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(FromTable(usersDB), LastModified("created"))
+	first := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+
+	// Lists are as recent as their latest result
+	assert.Equal(last, users.modified(
+		sql.Values{"created": first},
+		sql.Values{"created": last},
+		sql.Values{"created": nil},
+	))
+	assert.Equal(time.Time{}, users.modified())
+
+	// Without a last modified column there is no timestamp
+	users = Resource(FromTable(usersDB))
+	assert.Equal(time.Time{}, users.modified(sql.Values{"created": last}))
+}
+
+func TestResource_ConditionalGet(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(
+		FromTable(usersDB),
+		LastModified("created"),
+		CacheControl("private, max-age=5"),
+	)
+	users.conn = tx
+
+	_, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"secret"}`), nil,
+	))
+	require.Nil(t, errAPI)
+
+	list := MockRequest(nil, nil)
+	_, errAPI = users.List(list)
+	require.Nil(t, errAPI)
+	header := list.ResponseHeader()
+	assert.NotEqual("", header.Get("ETag"))
+	assert.NotEqual("", header.Get("Last-Modified"))
+	assert.Equal("private, max-age=5", header.Get("Cache-Control"))
+
+	list = MockRequest(nil, nil)
+	list.Header = http.Header{"If-None-Match": []string{header.Get("ETag")}}
+	response, errAPI := users.List(list)
+	require.Nil(t, errAPI)
+	assert.Equal(NotModified{}, response)
+
+	// Lists honour If-Modified-Since with the latest timestamp of the page
+	list = MockRequest(nil, nil)
+	list.Header = http.Header{"If-Modified-Since": []string{header.Get("Last-Modified")}}
+	response, errAPI = users.List(list)
+	require.Nil(t, errAPI)
+	assert.Equal(NotModified{}, response)
+
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	require.Nil(t, err)
+	list = MockRequest(nil, nil)
+	list.Header = http.Header{
+		"If-Modified-Since": []string{modified.Add(-time.Second).Format(http.TimeFormat)},
+	}
+	response, errAPI = users.List(list)
+	require.Nil(t, errAPI)
+	assert.NotEqual(NotModified{}, response)
+
+	// Changes produce a new tag
+	results := []sql.Values{{"id": int64(1)}}
+	assert.NotEqual(header.Get("ETag"), users.listETag(results))
+}
@@ -0,0 +1,234 @@
+package argo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+	"github.com/lib/pq"
+)
+
+// checkUniques confirms that no other entry shares the values of any of
+// the resource's uniqueness rules. Only rules with a column in changed
+// are checked; values must hold every column of those rules. The entry
+// with the given primary key, if any, is excluded from the check, and only
+// rows within the given scope are compared.
+func (c *ResourceSQL) checkUniques(conn sql.Connection, values, changed sql.Values, pk interface{}, scope sql.Values) *APIError {
+	err := NewError(400).SetErrorCode(CodeDuplicate)
+	key := c.table.PrimaryKey()[0]
+
+UNIQUES:
+	for _, elem := range c.uniques {
+		unique := elem.columns
+		var modified bool
+		for _, name := range unique {
+			if _, modified = changed[name]; modified {
+				break
+			}
+		}
+		if !modified {
+			continue
+		}
+
+		columns := make([]sql.Selectable, len(unique))
+		clauses := make([]sql.Clause, len(unique))
+		for i, name := range unique {
+			// Null values never conflict
+			if values[name] == nil {
+				continue UNIQUES
+			}
+			columns[i] = c.table.C[name]
+			clauses[i] = elem.clause(c.table.C[name], values[name])
+		}
+		if pk != nil {
+			clauses = append(clauses, c.table.C[key].DoesNotEqual(pk))
+		}
+		clauses = append(clauses, scopeClauses(c.table, scope)...)
+		stmt := sql.Select(columns...).Where(sql.AllOf(clauses...))
+
+		result := sql.Values{}
+		dbErr := conn.QueryOne(stmt, result)
+		if dbErr == sql.ErrNoResult {
+			continue
+		} else if dbErr != nil {
+			panic(fmt.Sprintf(
+				"argo: could not select uniques in sql resource (%s): %s",
+				stmt,
+				dbErr,
+			))
+		}
+
+		addDuplicate(err, unique)
+	}
+	if err.Exists() {
+		return err
+	}
+	return nil
+}
+
+// addDuplicate adds an error to each of the given columns, whose values
+// together already exist
+func addDuplicate(err *APIError, unique []string) {
+	for i, name := range unique {
+		if len(unique) == 1 {
+			err.AddField(name, Message(CodeDuplicate, nil))
+			continue
+		}
+		others := make([]string, 0, len(unique)-1)
+		others = append(others, unique[:i]...)
+		others = append(others, unique[i+1:]...)
+		err.AddField(name, Message(
+			CodeDuplicateTogether,
+			map[string]interface{}{"columns": strings.Join(others, ", ")},
+		))
+	}
+}
+
+// duplicateColumns returns the columns of a unique violation from the
+// detail of the Postgres error, such as "Key (a, b)=(1, 2) already
+// exists.", or nil if the key is an expression
+func duplicateColumns(detail string) []string {
+	if !strings.HasPrefix(detail, "Key (") {
+		return nil
+	}
+	end := strings.Index(detail, ")=(")
+	if end == -1 {
+		return nil
+	}
+	columns := strings.Split(detail[len("Key ("):end], ", ")
+	for _, name := range columns {
+		if name == "" || strings.ContainsAny(name, "() :") {
+			return nil
+		}
+	}
+	return columns
+}
+
+// References returns a Modifier that checks the values of the given
+// foreign key column against the rows visible to the target resource,
+// which must be backed by the referenced table. Values that reference rows
+// outside the scope of the target, or rows it has soft deleted, are
+// invalid. Foreign keys without a target are checked within the scope of
+// the resource itself, as includes are, and may reference soft deleted
+// rows.
+func References(name string, target *ResourceSQL) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, fk := range resource.table.ForeignKeys() {
+			if fk.Name() != name {
+				continue
+			}
+			if fk.ReferencesTable() != target.table {
+				return fmt.Errorf(
+					"argo: the foreign key '%s' of '%s' does not reference the table of '%s'",
+					name,
+					resource.Name,
+					target.Name,
+				)
+			}
+			if resource.references == nil {
+				resource.references = make(map[string]*ResourceSQL)
+			}
+			resource.references[name] = target
+			return nil
+		}
+		return fmt.Errorf(
+			"argo: '%s' is not a foreign key of '%s'",
+			name,
+			resource.Name,
+		)
+	})
+}
+
+// checkForeignKeys confirms that every foreign key value in the given
+// values references an existing row. Rows are looked up within the scope
+// of the target resource given by References, if any, or else within the
+// given scope of the resource.
+func (c *ResourceSQL) checkForeignKeys(r *Request, values, scope sql.Values) *APIError {
+	err := NewError(400).SetErrorCode(CodeInvalidReference)
+	for _, fk := range c.table.ForeignKeys() {
+		value, exists := values[fk.Name()]
+		if !exists || value == nil {
+			continue
+		}
+		table := fk.ReferencesTable()
+		column := table.C[fk.ForeignName()]
+		clauses := []sql.Clause{column.Equals(value)}
+		if target, exists := c.references[fk.Name()]; exists {
+			targetScope, apiErr := target.scoped(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			clauses = append(clauses, scopeClauses(table, targetScope)...)
+			if target.softDelete != nil {
+				clauses = append(clauses, target.softDelete.visible())
+			}
+		} else {
+			clauses = append(clauses, scopeClauses(table, scope)...)
+		}
+		stmt := sql.Select(column).Where(sql.AllOf(clauses...))
+
+		var result interface{}
+		dbErr := r.Tx.QueryOne(stmt, &result)
+		if dbErr == sql.ErrNoResult {
+			err.AddField(fk.Name(), Message(CodeInvalidReference, nil))
+		} else if dbErr != nil {
+			panic(fmt.Sprintf(
+				"argo: could not select foreign keys in sql resource (%s): %s",
+				stmt,
+				dbErr,
+			))
+		}
+	}
+	if err.Exists() {
+		return err
+	}
+	return nil
+}
+
+// Postgres error codes of integrity constraint violations
+const (
+	notNullViolation    = "23502"
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+	checkViolation      = "23514"
+)
+
+// constraintError converts database constraint violations, such as those
+// caused by a concurrent write after the pre-checks, into API errors. It
+// returns nil for all other errors.
+func constraintError(err error) *APIError {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+	var apiErr *APIError
+	switch pqErr.Code {
+	case uniqueViolation:
+		// The same status and field errors as checkUniques
+		if columns := duplicateColumns(pqErr.Detail); columns != nil {
+			apiErr = NewError(400).SetErrorCode(CodeDuplicate)
+			addDuplicate(apiErr, columns)
+			return apiErr
+		}
+		apiErr = MessageError(400, CodeDuplicate, nil)
+	case foreignKeyViolation:
+		// Deletes are blocked by rows that still reference them
+		if strings.HasPrefix(pqErr.Message, "update or delete") {
+			return MessageError(409, CodeReferenced, nil)
+		}
+		apiErr = MessageError(400, CodeInvalidReference, nil)
+	case notNullViolation:
+		apiErr = MessageError(400, CodeMissingField, nil)
+	case checkViolation:
+		apiErr = MessageError(
+			400, CodeCheckViolation, nil,
+		).SetErrorCode(CodeInvalidField)
+	default:
+		return nil
+	}
+	if pqErr.Column != "" {
+		apiErr.AddField(pqErr.Column, apiErr.metaErrors[0])
+	}
+	return apiErr
+}
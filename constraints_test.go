@@ -0,0 +1,82 @@
+package argo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraintError(t *testing.T) {
+	assert := assert.New(t)
+
+	// Non-constraint errors are not converted
+	assert.Nil(constraintError(fmt.Errorf("connection refused")))
+	assert.Nil(constraintError(&pq.Error{Code: "42P01"}))
+
+	// Duplicates have the status and field errors of checkUniques
+	apiErr := constraintError(&pq.Error{Code: uniqueViolation})
+	assert.Equal(400, apiErr.code)
+	assert.Equal(CodeDuplicate, apiErr.ErrorCode())
+
+	apiErr = constraintError(&pq.Error{
+		Code:   uniqueViolation,
+		Detail: `Key (name)=(admin) already exists.`,
+	})
+	assert.Equal(400, apiErr.code)
+	assert.Equal(CodeDuplicate, apiErr.errorsOf("name")[0].Code)
+
+	apiErr = constraintError(&pq.Error{
+		Code:   uniqueViolation,
+		Detail: `Key (a, b)=(2, 3) already exists.`,
+	})
+	assert.Equal(CodeDuplicateTogether, apiErr.errorsOf("a")[0].Code)
+	assert.Equal(CodeDuplicateTogether, apiErr.errorsOf("b")[0].Code)
+
+	apiErr = constraintError(&pq.Error{
+		Code:    foreignKeyViolation,
+		Message: `update or delete on table "companies" violates foreign key constraint`,
+	})
+	assert.Equal(409, apiErr.code)
+
+	apiErr = constraintError(&pq.Error{
+		Code:    foreignKeyViolation,
+		Message: `insert or update on table "contacts" violates foreign key constraint`,
+	})
+	assert.Equal(400, apiErr.code)
+
+	apiErr = constraintError(&pq.Error{Code: notNullViolation, Column: "name"})
+	assert.Equal(400, apiErr.code)
+	assert.NotNil(apiErr.Fields["name"])
+}
+
+func TestDuplicateColumns(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"name"}, duplicateColumns(`Key (name)=(admin) already exists.`))
+	assert.Equal([]string{"a", "b"}, duplicateColumns(`Key (a, b)=(2, 3) already exists.`))
+
+	// Expression indexes have no columns
+	assert.Nil(duplicateColumns(`Key (lower(name::text))=(admin) already exists.`))
+	assert.Nil(duplicateColumns(""))
+}
+
+func TestReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	// companyDB lives in many_to_many_test.go and contactsDB in many_test.go
+	companies := Resource(FromTable(companyDB))
+	assert.NotPanics(func() {
+		Resource(FromTable(contactsDB), References("company_id", companies))
+	})
+	assert.Panics(func() {
+		Resource(FromTable(contactsDB), References("key", companies))
+	})
+	assert.Panics(func() {
+		Resource(
+			FromTable(contactsDB),
+			References("company_id", Resource(FromTable(usersDB))),
+		)
+	})
+}
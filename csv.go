@@ -0,0 +1,238 @@
+package argo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	sql "github.com/aodin/aspect"
+)
+
+// CSV implements RFC 4180 encoding of results, one row per result. The
+// columns of lists follow the order of the resource table, followed by
+// their includes, or without them if DropIncludes is set. Includes are
+// flattened into a column per included field, named include.field, whose
+// cell holds the values of every included row separated by newlines.
+// Includes that are maps have a column per key instead.
+type CSV struct {
+	DropIncludes bool
+}
+
+func (c CSV) Encode(i interface{}) []byte {
+	var fields []string
+	var rows []sql.Values
+	switch response := i.(type) {
+	case MultiResponse:
+		fields = response.fields
+		rows, _ = response.Results.([]sql.Values)
+	case []sql.Values:
+		rows = response
+	case sql.Values:
+		rows = []sql.Values{response}
+	case *APIError:
+		return c.encodeError(response)
+	case APIError:
+		return c.encodeError(&response)
+	case map[string]string:
+		return c.encodeMap(response)
+	default:
+		// Responses that are not rows are written as a single JSON cell
+		b, err := json.Marshal(i)
+		if err != nil {
+			panic(fmt.Sprintf("argo: could not CSV encode response: %s", err))
+		}
+		return c.encodeRecords([][]string{{string(b)}})
+	}
+
+	var buffer bytes.Buffer
+	if err := c.WriteRows(&buffer, fields, &valuesRows{rows: rows}); err != nil {
+		panic(fmt.Sprintf("argo: could not CSV encode response: %s", err))
+	}
+	return buffer.Bytes()
+}
+
+// EncodeTo implements the StreamEncoder interface. Streams are written
+// with WriteRows, without their meta.
+func (c CSV) EncodeTo(w io.Writer, i interface{}) error {
+	if stream, ok := i.(StreamResponse); ok {
+		return c.WriteRows(w, stream.Fields, stream.Rows)
+	}
+	_, err := w.Write(c.Encode(i))
+	return err
+}
+
+func (c CSV) MediaType() string {
+	return "text/csv"
+}
+
+// WriteRows implements the RowWriter interface. The given fields are
+// written first, even if there are no rows; any other fields of the first
+// row follow in alphabetical order.
+func (c CSV) WriteRows(w io.Writer, fields []string, rows Rows) error {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+
+	first, err := rows.Next()
+	if err != nil {
+		return err
+	}
+	header := c.header(fields, first)
+	if err = writer.Write(header); err != nil {
+		return err
+	}
+
+	for row := first; row != nil; {
+		if !c.DropIncludes {
+			row = c.flatten(row)
+		}
+		record := make([]string, len(header))
+		for i, name := range header {
+			record[i] = c.cell(row[name])
+		}
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+		// Flush each row so that streams are not buffered
+		writer.Flush()
+		if err = writer.Error(); err != nil {
+			return err
+		}
+		if row, err = rows.Next(); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// header returns the columns of the rows
+func (c CSV) header(fields []string, first sql.Values) []string {
+	header := append([]string{}, fields...)
+	known := make(map[string]bool)
+	for _, name := range fields {
+		known[name] = true
+	}
+	if !c.DropIncludes {
+		first = c.flatten(first)
+	}
+	extra := make([]string, 0)
+	for name, value := range first {
+		if known[name] || c.DropIncludes && !isScalar(value) {
+			continue
+		}
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(header, extra...)
+}
+
+// isScalar returns false for the lists and maps of includes
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case []sql.Values, []interface{}, map[string]interface{}, sql.Values:
+		return false
+	}
+	return true
+}
+
+// flatten replaces the includes of the row with a value per included
+// field, named include.field. The values of lists are the cells of every
+// included row, separated by newlines.
+func (c CSV) flatten(row sql.Values) sql.Values {
+	flat := sql.Values{}
+	for name, value := range row {
+		switch v := value.(type) {
+		case []sql.Values:
+			cells := make(map[string][]string)
+			for i, included := range v {
+				for field, value := range included {
+					if cells[field] == nil {
+						cells[field] = make([]string, len(v))
+					}
+					cells[field][i] = c.cell(value)
+				}
+			}
+			for field, values := range cells {
+				flat[name+"."+field] = strings.Join(values, "\n")
+			}
+		case map[string]interface{}:
+			for key, value := range v {
+				flat[name+"."+key] = value
+			}
+		case sql.Values:
+			for key, value := range v {
+				flat[name+"."+key] = value
+			}
+		default:
+			flat[name] = value
+		}
+	}
+	return flat
+}
+
+// cell formats a single value
+func (c CSV) cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool, int, int32, int64, float32, float64:
+		return fmt.Sprint(v)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("argo: could not CSV encode value: %s", err))
+	}
+	return string(b)
+}
+
+func (c CSV) encodeError(e *APIError) []byte {
+	records := [][]string{{"field", "error"}}
+	for _, meta := range e.Meta {
+		records = append(records, []string{"", meta})
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, err := range e.errorsOf(name) {
+			records = append(records, []string{name, err.Message})
+		}
+	}
+	return c.encodeRecords(records)
+}
+
+func (c CSV) encodeMap(m map[string]string) []byte {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	records := [][]string{{"name", "value"}}
+	for _, name := range names {
+		records = append(records, []string{name, m[name]})
+	}
+	return c.encodeRecords(records)
+}
+
+func (c CSV) encodeRecords(records [][]string) []byte {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.UseCRLF = true
+	if err := writer.WriteAll(records); err != nil {
+		panic(fmt.Sprintf("argo: could not CSV encode response: %s", err))
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,220 @@
+package argo
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	response := MultiResponse{
+		Results: []sql.Values{
+			{
+				"id":      int64(1),
+				"name":    `Say "hi", Bob`,
+				"created": created,
+				"tags":    []sql.Values{{"name": "a"}, {"name": "b"}},
+			},
+			{"id": int64(2), "name": "line\nbreak", "created": nil, "tags": nil},
+		},
+		fields: []string{"id", "name", "created", "tags.name"},
+	}
+	assert.Equal(
+		"id,name,created,tags.name\r\n"+
+			`1,"Say ""hi"", Bob",2015-01-02T03:04:05Z,"a`+"\r\n"+`b"`+"\r\n"+
+			"2,\"line\r\nbreak\",,\r\n",
+		string(CSV{}.Encode(response)),
+	)
+
+	// Includes can be dropped
+	response.fields = []string{"id", "name", "created"}
+	assert.Equal(
+		"id,name,created\r\n"+
+			`1,"Say ""hi"", Bob",2015-01-02T03:04:05Z`+"\r\n"+
+			"2,\"line\r\nbreak\",\r\n",
+		string(CSV{DropIncludes: true}.Encode(response)),
+	)
+
+	// Includes that are maps have a column per key
+	assert.Equal(
+		"id,tags.a,tags.b\r\n1,x,y\r\n",
+		string(CSV{}.Encode(sql.Values{
+			"id":   int64(1),
+			"tags": map[string]interface{}{"a": "x", "b": "y"},
+		})),
+	)
+
+	// Single results without a known order are sorted
+	assert.Equal(
+		"a,b\r\n1,true\r\n",
+		string(CSV{}.Encode(sql.Values{"b": true, "a": int64(1)})),
+	)
+
+	apiErr := MetaError(400, "bad")
+	apiErr.SetField("name", "is required")
+	assert.Equal(
+		"field,error\r\n,bad\r\nname,is required\r\n",
+		string(CSV{}.Encode(*apiErr)),
+	)
+}
+
+func TestCSV_WriteRows(t *testing.T) {
+	assert := assert.New(t)
+
+	var buffer bytes.Buffer
+	rows := &valuesRows{}
+	require.Nil(t, CSV{}.WriteRows(&buffer, []string{"id", "name"}, rows))
+	assert.Equal("id,name\r\n", buffer.String())
+}
+
+func TestResourceSQL_RowFields(t *testing.T) {
+	assert := assert.New(t)
+
+	companies := Resource(FromTable(companyDB), Many("contacts", contactsDB))
+	r := MockRequest(nil, nil)
+	r.Encoding = CSV{}
+	fields := companies.rowFields(r, companies.fieldOrder(r))
+	assert.Equal(
+		[]string{"contacts.id", "contacts.key", "contacts.value"},
+		fields[len(fields)-3:],
+	)
+
+	// Empty lists still have a header with their includes
+	var buffer bytes.Buffer
+	require.Nil(t, CSV{}.WriteRows(&buffer, fields, &valuesRows{}))
+	assert.Equal(strings.Join(fields, ",")+"\r\n", buffer.String())
+
+	// Includes are left out if the encoder drops them
+	r.Encoding = CSV{DropIncludes: true}
+	assert.Equal(companies.fieldOrder(r), companies.rowFields(r, companies.fieldOrder(r)))
+
+	// Other encoders keep the include as a single field
+	r.Encoding = JSON{}
+	fields = companies.rowFields(r, companies.fieldOrder(r))
+	assert.Equal("contacts", fields[len(fields)-1])
+}
+
+func TestGetEncoder(t *testing.T) {
+	assert := assert.New(t)
+
+	request := func(query, accept string) *http.Request {
+		r := &http.Request{
+			URL:    &url.URL{RawQuery: query},
+			Header: http.Header{},
+		}
+		r.Header.Set("Accept", accept)
+		return r
+	}
+	assert.Equal(JSON{}, GetEncoder(request("", "")))
+	assert.Equal(CSV{}, GetEncoder(request("format=csv", "")))
+	assert.Equal(CSV{}, GetEncoder(request("", "text/csv;q=0.9, */*")))
+	assert.Equal(JSON{}, GetEncoder(request("format=json", "text/csv")))
+}
+
+func TestResource_Export(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(FromTable(usersDB), WriteOnly("password"))
+	users.conn = tx
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, errAPI := users.Post(MockRequest(
+			[]byte(`{"name":"`+name+`","age":1,"password":"x"}`), nil,
+		))
+		require.Nil(t, errAPI)
+	}
+
+	// Exports ignore the limit
+	r := MockRequest(nil, url.Values{
+		"export": []string{"true"},
+		"limit":  []string{"1"},
+		"order":  []string{"name"},
+	})
+	r.Encoding = CSV{}
+	response, errAPI := users.List(r)
+	require.Nil(t, errAPI)
+	export := response.(Export)
+	assert.Equal([]string{"id", "name", "age", "is_active", "created"}, export.Fields)
+
+	var buffer bytes.Buffer
+	require.Nil(t, CSV{}.WriteRows(&buffer, export.Fields, export.Rows))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\r\n")
+	assert.Equal(4, len(lines))
+	assert.Equal(`attachment; filename="users.csv"`, r.ResponseHeader().Get("Content-Disposition"))
+
+	// Other encoders cannot export
+	r = MockRequest(nil, url.Values{"export": []string{"true"}})
+	r.Encoding = YAML{}
+	_, errAPI = users.List(r)
+	assert.NotNil(errAPI)
+}
+
+func TestResource_ExportIncludes(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, companyDB, contactsDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	// Includes are queried on the transaction between the batches of the
+	// export, which would fail while the rows of a batch are open
+	companies := Resource(FromTable(companyDB), Many("contacts", contactsDB))
+	companies.conn = tx
+	for _, name := range []string{"a", "b", "c"} {
+		_, errAPI := companies.Post(MockRequest([]byte(`{"name":"`+name+`"}`), nil))
+		require.Nil(t, errAPI)
+	}
+
+	r := MockRequest(nil, url.Values{"export": []string{"true"}})
+	r.Encoding = CSV{}
+	response, errAPI := companies.List(r)
+	require.Nil(t, errAPI)
+	export := response.(Export)
+	assert.Equal("contacts.value", export.Fields[len(export.Fields)-1])
+
+	var buffer bytes.Buffer
+	require.Nil(t, CSV{}.WriteRows(&buffer, export.Fields, export.Rows))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\r\n")
+	assert.Equal(4, len(lines))
+}
+
+func TestAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	name, id := usersDB.C["name"], usersDB.C["id"]
+	keys := []sortKey{{column: name, desc: true}, {column: id}}
+
+	// Rows after the last one sort lower by name, or tie and sort higher
+	// by id
+	assert.Equal(
+		sql.AnyOf(
+			sql.AllOf(name.LessThan("b")),
+			sql.AllOf(name.Equals("b"), sql.AnyOf(id.GreaterThan(2), id.IsNull())),
+		),
+		after(keys, sql.Values{"name": "b", "id": 2}),
+	)
+
+	// Descending NULLs sort first, so every other name is after them
+	assert.Equal(
+		sql.AnyOf(
+			sql.AllOf(name.IsNotNull()),
+			sql.AllOf(name.IsNull(), sql.AnyOf(id.GreaterThan(2), id.IsNull())),
+		),
+		after(keys, sql.Values{"name": nil, "id": 2}),
+	)
+
+	// Nothing sorts after an ascending NULL
+	assert.Nil(after([]sortKey{{column: id}}, sql.Values{"id": nil}))
+}
@@ -1,10 +1,14 @@
 package argo
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
+	"strconv"
+	"strings"
 
 	sql "github.com/aodin/aspect"
 	"gopkg.in/yaml.v2"
@@ -21,17 +25,117 @@ type Encoder interface {
 	MediaType() string
 }
 
-// JSON implements JSON encoding and decoding
-type JSON struct{}
+// JSON implements JSON encoding and decoding. Numbers are decoded as
+// int64 when they are integers and as float64 otherwise, unless that would
+// lose precision: integers beyond int64 and decimals that have no exact
+// float64 representation, such as those of NUMERIC columns, are kept as
+// json.Number.
+//
+// Strict decoding rejects duplicate keys at any depth, top-level values
+// other than an object, and data after the object.
+type JSON struct {
+	Strict bool
+}
 
 func (c JSON) Decode(data io.Reader) (sql.Values, *APIError) {
 	values := sql.Values{}
-	if err := json.NewDecoder(data).Decode(&values); err != nil {
-		return values, MetaError(400, err.Error())
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return values, invalidRequest(err)
 	}
+	if c.Strict {
+		if err = checkStrictJSON(b); err != nil {
+			return values, invalidRequest(err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err = decoder.Decode(&values); err != nil {
+		return values, invalidRequest(err)
+	}
+	fixNumbers(values)
 	return values, nil
 }
 
+// checkStrictJSON confirms that the data is a single JSON object without
+// duplicate keys at any depth
+func checkStrictJSON(b []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("the request body must be a JSON object")
+	}
+	if err = checkDuplicateKeys(decoder, '{'); err != nil {
+		return err
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return fmt.Errorf("the request body has data after the JSON object")
+	}
+	return nil
+}
+
+// checkDuplicateKeys walks the tokens of the object or array that has
+// just been opened, until it is closed
+func checkDuplicateKeys(decoder *json.Decoder, open json.Delim) error {
+	keys := make(map[string]bool)
+	for decoder.More() {
+		if open == '{' {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			if keys[key] {
+				return fmt.Errorf("the key '%s' is duplicated", key)
+			}
+			keys[key] = true
+		}
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if err = checkDuplicateKeys(decoder, delim); err != nil {
+				return err
+			}
+		}
+	}
+	// Consume the closing delimiter
+	_, err := decoder.Token()
+	return err
+}
+
+// fixNumbers converts the json.Number values of decoded JSON into int64
+// or float64 where it is lossless, at any depth
+func fixNumbers(values map[string]interface{}) {
+	for key, value := range values {
+		values[key] = fixNumber(value)
+	}
+}
+
+func fixNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, ok := exactFloat(v); ok {
+			return f
+		}
+		return v
+	case map[string]interface{}:
+		fixNumbers(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = fixNumber(v[i])
+		}
+	}
+	return value
+}
+
 func (c JSON) Encode(i interface{}) []byte {
 	// TODO turn off pretty printing by default?
 	b, err := json.MarshalIndent(i, "", "  ")
@@ -44,22 +148,91 @@ func (c JSON) Encode(i interface{}) []byte {
 	return b
 }
 
+// EncodeTo implements the StreamEncoder interface. The results of streams
+// are written one row at a time, without indentation.
+func (c JSON) EncodeTo(w io.Writer, i interface{}) error {
+	stream, ok := i.(StreamResponse)
+	if !ok {
+		_, err := w.Write(c.Encode(i))
+		return err
+	}
+	meta, err := json.Marshal(stream.Meta)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, `{"meta":%s,"results":`, meta); err != nil {
+		return err
+	}
+	if err = c.WriteRows(w, stream.Fields, stream.Rows); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}")
+	return err
+}
+
+// WriteRows implements the RowWriter interface by writing the rows as a
+// JSON array, one row at a time
+func (c JSON) WriteRows(w io.Writer, fields []string, rows Rows) error {
+	delimiter := "["
+	for {
+		row, err := rows.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		b, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, delimiter+string(b)); err != nil {
+			return err
+		}
+		delimiter = ","
+	}
+	if delimiter == "[" {
+		_, err := io.WriteString(w, "[]")
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
 func (c JSON) MediaType() string {
 	return "application/json"
 }
 
-// YAML implements YAML encoding and decoding
-type YAML struct{}
+// YAML implements YAML encoding and decoding. Strict decoding rejects
+// duplicate keys, unknown tags and documents after the first.
+type YAML struct {
+	Strict bool
+}
 
 func (c YAML) Decode(data io.Reader) (sql.Values, *APIError) {
 	values := sql.Values{}
-	// TODO limit reader
+	// The body is limited by the API, see MaxBodySize
 	b, err := ioutil.ReadAll(data)
 	if err != nil {
-		return values, MetaError(400, err.Error())
+		return values, invalidRequest(err)
+	}
+	if !c.Strict {
+		if err = yaml.Unmarshal(b, &values); err != nil {
+			return values, invalidRequest(err)
+		}
+		return values, nil
 	}
-	if err = yaml.Unmarshal(b, &values); err != nil {
-		return values, MetaError(400, err.Error())
+
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.SetStrict(true)
+	if err = decoder.Decode(&values); err != nil {
+		return values, invalidRequest(err)
+	}
+	var extra interface{}
+	if err = decoder.Decode(&extra); err != io.EOF {
+		return values, MessageError(
+			400, CodeTrailingData, nil,
+		).SetErrorCode(CodeInvalidRequest)
 	}
 	return values, nil
 }
@@ -78,3 +251,21 @@ func (c YAML) Encode(i interface{}) []byte {
 func (c YAML) MediaType() string {
 	return "application/x-yaml"
 }
+
+// exactFloat converts the number to a float64 if its shortest
+// representation has the same decimal value as the number
+func exactFloat(number json.Number) (float64, bool) {
+	if !strings.ContainsAny(string(number), ".eE") {
+		return 0, false // An integer beyond int64
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return 0, false
+	}
+	exact, ok := new(big.Rat).SetString(string(number))
+	if !ok {
+		return 0, false
+	}
+	shortest, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return f, exact.Cmp(shortest) == 0
+}
@@ -0,0 +1,72 @@
+package argo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON_Decode(t *testing.T) {
+	assert := assert.New(t)
+
+	// Integers keep their precision
+	values, err := JSON{}.Decode(strings.NewReader(
+		`{"id":9007199254740993,"price":1.5,"tags":[1,{"n":2}]}`,
+	))
+	require.Nil(t, err)
+	assert.Equal(int64(9007199254740993), values["id"])
+	assert.Equal(1.5, values["price"])
+	assert.Equal(
+		[]interface{}{int64(1), map[string]interface{}{"n": int64(2)}},
+		values["tags"],
+	)
+
+	// Numbers that would lose precision are kept as json.Number
+	values, err = JSON{}.Decode(strings.NewReader(
+		`{"big":9223372036854775808,"decimal":3.14159265358979323846264338327950288,"small":0.1}`,
+	))
+	require.Nil(t, err)
+	assert.Equal(json.Number("9223372036854775808"), values["big"])
+	assert.Equal(
+		json.Number("3.14159265358979323846264338327950288"),
+		values["decimal"],
+	)
+	assert.Equal(0.1, values["small"])
+
+	// Validators accept them
+	_, validateErr := Range(0, 4).Validate(values["decimal"])
+	assert.Nil(validateErr)
+	_, validateErr = Range(0, 4).Validate(values["big"])
+	assert.NotNil(validateErr)
+	_, validateErr = Enum("9223372036854775808").Validate(values["big"])
+	assert.Nil(validateErr)
+
+	// Lenient decoding ignores trailing data and duplicate keys
+	values, err = JSON{}.Decode(strings.NewReader(`{"a":1,"a":2} {}`))
+	require.Nil(t, err)
+	assert.Equal(sql.Values{"a": int64(2)}, values)
+
+	strict := JSON{Strict: true}
+	_, err = strict.Decode(strings.NewReader(`{"a":1,"b":{"c":[{"d":1}]}}`))
+	assert.Nil(err)
+
+	invalid := []string{
+		`{"a":1,"a":2}`,
+		`{"a":{"b":1,"b":2}}`,
+		`{"a":[{"b":1,"b":2}]}`,
+		`{"a":1} {}`,
+		`{"a":1} x`,
+		`[{"a":1}]`,
+		`null`,
+		`"a"`,
+		``,
+	}
+	for _, body := range invalid {
+		_, err = strict.Decode(strings.NewReader(body))
+		assert.NotNil(err, body)
+	}
+}
@@ -1,21 +1,138 @@
 package argo
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 )
 
-// APIError is an error structure with meta and field-specific errors
+// APIError is an error structure with meta and field-specific errors.
+// Fields are keyed by the path of the field, see FieldPath. Each field may
+// have several errors, which are kept in FieldErrors with their codes and
+// parameters; Fields has their messages joined as one.
+//
+// By default errors are encoded in their original shape, with a single
+// message per field. Errors of APIs with StructuredErrors include every
+// FieldError and the error code.
 type APIError struct {
-	code   int
-	Meta   []string          `json:"meta"`
-	Fields map[string]string `json:"fields"`
+	code        int
+	errorCode   string // Machine-readable, see ErrorCode
+	structured  bool
+	metaErrors  []FieldError // The codes and parameters of Meta
+	Meta        []string
+	Fields      map[string]string
+	FieldErrors map[string][]FieldError
+}
+
+// FieldError is a single error of a field. Its code and parameters allow
+// clients to build their own messages.
+type FieldError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+
+	templated bool // Created by Message, so that it can be translated
+}
+
+// Error implements the error interface, so that validators can return
+// field errors
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// FieldErrors are the errors of validators that report several problems
+// with a value at once
+type FieldErrors []FieldError
+
+// Error implements the error interface
+func (errs FieldErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// fieldErrors converts the error of a validator into field errors
+func fieldErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case FieldError:
+		return []FieldError{e}
+	case FieldErrors:
+		return e
+	}
+	// Other errors keep their messages, see typeErrors for column types
+	return []FieldError{
+		Message(CodeInvalidValue, map[string]interface{}{"reason": err.Error()}),
+	}
+}
+
+// FieldPath joins the names and indexes of a nested field, such as
+// FieldPath("contacts", 0, "key"), which is "contacts.0.key"
+func FieldPath(parts ...interface{}) string {
+	path := make([]string, len(parts))
+	for i, part := range parts {
+		path[i] = fmt.Sprint(part)
+	}
+	return strings.Join(path, ".")
+}
+
+// Error codes identify the failure of a request independently of its
+// messages. Errors without one of their own use the code of their status.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidField         = "invalid_field"
+	CodeInvalidValue         = "invalid_value"
+	CodeUnknownField         = "unknown_field"
+	CodeReadOnly             = "read_only"
+	CodeCreateOnly           = "create_only"
+	CodeInvalidKey           = "invalid_key"
+	CodeMissingField         = "missing_field"
+	CodeEmptyRequest         = "empty_request"
+	CodeDuplicate            = "duplicate"
+	CodeDuplicateTogether    = "duplicate_together"
+	CodeInvalidReference     = "invalid_reference"
+	CodeReferenced           = "referenced"
+	CodeUnsupportedMethod    = "unsupported_method"
+	CodeUnsupportedFormat    = "unsupported_format"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePreconditionRequired = "precondition_required"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal"
+)
+
+// statusCodes are the error codes of each status
+var statusCodes = map[int]string{
+	400: CodeInvalidRequest,
+	401: CodeUnauthorized,
+	403: CodeForbidden,
+	404: CodeNotFound,
+	409: CodeConflict,
+	412: CodePreconditionFailed,
+	413: CodeBodyTooLarge,
+	415: CodeUnsupportedMediaType,
+	428: CodePreconditionRequired,
+	429: CodeRateLimited,
 }
 
 // AddMeta appends a meta error
 func (e *APIError) AddMeta(msg string, args ...interface{}) {
-	e.Meta = append(e.Meta, fmt.Sprintf(msg, args...))
+	e.AddMetaError(FieldError{Message: fmt.Sprintf(msg, args...)})
+}
+
+// AddMetaError appends a meta error with its code and parameters, so that
+// it can be translated. Errors without a code have the code of the
+// APIError.
+func (e *APIError) AddMetaError(err FieldError) {
+	e.metaErrors = append(e.metaErrors, err)
+	e.Meta = append(e.Meta, err.Message)
 }
 
 // Code returns the status code that should be written to the response
@@ -23,6 +140,23 @@ func (e APIError) Code() int {
 	return e.code
 }
 
+// ErrorCode returns the machine-readable code of the error
+func (e APIError) ErrorCode() string {
+	if e.errorCode != "" {
+		return e.errorCode
+	}
+	if code, exists := statusCodes[e.code]; exists {
+		return code
+	}
+	return CodeInternal
+}
+
+// SetErrorCode sets the machine-readable code of the error
+func (e *APIError) SetErrorCode(code string) *APIError {
+	e.errorCode = code
+	return e
+}
+
 // Error implements the error interface
 func (e APIError) Error() string {
 	return fmt.Sprintf("%d: %s", e.code, strings.Join(e.Meta, "; "))
@@ -33,33 +167,126 @@ func (e APIError) Exists() bool {
 	return len(e.Meta) > 0 || len(e.Fields) > 0
 }
 
-// SetField sets the error message for the field. Mutiple calls will overwrite
-// previous messages for that field.
+// SetField adds an error message for the field, with the error code of
+// the APIError. Multiple calls add multiple errors.
 func (e *APIError) SetField(field, msg string, args ...interface{}) {
-	e.Fields[field] = fmt.Sprintf(msg, args...)
+	code := e.errorCode
+	if code == "" {
+		code = CodeInvalidField
+	}
+	e.AddField(field, FieldError{Code: code, Message: fmt.Sprintf(msg, args...)})
+}
+
+// AddField adds the errors to the field
+func (e *APIError) AddField(field string, errs ...FieldError) {
+	if e.FieldErrors == nil {
+		e.FieldErrors = make(map[string][]FieldError)
+	}
+	e.FieldErrors[field] = append(e.errorsOf(field), errs...)
+	e.Fields[field] = FieldErrors(e.FieldErrors[field]).Error()
+}
+
+// Field returns the messages of the field joined as a single message, or
+// an empty string if the field has no errors
+func (e APIError) Field(field string) string {
+	return e.Fields[field]
+}
+
+// errorsOf returns the structured errors of the field. Messages that
+// were set in Fields directly have the code of the APIError.
+func (e APIError) errorsOf(field string) []FieldError {
+	msg, exists := e.Fields[field]
+	if !exists {
+		return nil
+	}
+	if errs := e.FieldErrors[field]; FieldErrors(errs).Error() == msg {
+		return errs
+	}
+	return []FieldError{{Code: e.ErrorCode(), Message: msg}}
+}
+
+// structuredFields returns the structured errors of every field
+func (e APIError) structuredFields() map[string][]FieldError {
+	fields := make(map[string][]FieldError, len(e.Fields))
+	for field := range e.Fields {
+		fields[field] = e.errorsOf(field)
+	}
+	return fields
+}
+
+// Nest adds the errors of another APIError under the given path. Its meta
+// errors become errors of the path itself.
+func (e *APIError) Nest(path string, other *APIError) {
+	for i, meta := range other.Meta {
+		if i < len(other.metaErrors) && other.metaErrors[i].Message == meta {
+			err := other.metaErrors[i]
+			if err.Code == "" {
+				err.Code = other.ErrorCode()
+			}
+			e.AddField(path, err)
+			continue
+		}
+		e.AddField(path, FieldError{Code: other.ErrorCode(), Message: meta})
+	}
+	for field := range other.Fields {
+		e.AddField(FieldPath(path, field), other.errorsOf(field)...)
+	}
+}
+
+// StructuredErrors writes every error of the API with its error code and
+// the list of structured errors of each field, instead of a single message
+// per field.
+func (api *API) StructuredErrors() *API {
+	api.structuredErrors = true
+	return api
+}
+
+// body returns the representation of the error that is encoded
+func (e APIError) body() interface{} {
+	if e.structured {
+		return struct {
+			Code   string                  `json:"code" yaml:"code"`
+			Meta   []string                `json:"meta" yaml:"meta"`
+			Fields map[string][]FieldError `json:"fields" yaml:"fields"`
+		}{Code: e.ErrorCode(), Meta: e.Meta, Fields: e.structuredFields()}
+	}
+	return struct {
+		Meta   []string          `json:"meta" yaml:"meta"`
+		Fields map[string]string `json:"fields" yaml:"fields"`
+	}{Meta: e.Meta, Fields: e.Fields}
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (e APIError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.body())
+}
+
+// MarshalYAML implements the yaml.Marshaler interface
+func (e APIError) MarshalYAML() (interface{}, error) {
+	return e.body(), nil
 }
 
 // Write writes the error to the response using the given encoder
 func (e APIError) Write(w http.ResponseWriter, encoder Encoder) {
-	w.WriteHeader(e.code)
+	// Headers cannot be changed once the status has been written
 	w.Header().Set("Content-Type", encoder.MediaType())
+	w.WriteHeader(e.code)
 	w.Write(encoder.Encode(e))
 }
 
 // New creates a new empty API error scaffold
 func NewError(code int) *APIError {
 	return &APIError{
-		code:   code,
-		Meta:   make([]string, 0), // So JSON meta is never null
-		Fields: make(map[string]string),
+		code:        code,
+		Meta:        make([]string, 0), // So JSON meta is never null
+		Fields:      make(map[string]string),
+		FieldErrors: make(map[string][]FieldError),
 	}
 }
 
 // MetaError returns an API error with a pre-set meta error
 func MetaError(code int, msg string, args ...interface{}) *APIError {
-	return &APIError{
-		code:   code,
-		Meta:   []string{fmt.Sprintf(msg, args...)},
-		Fields: make(map[string]string),
-	}
+	e := NewError(code)
+	e.AddMeta(msg, args...)
+	return e
 }
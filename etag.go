@@ -0,0 +1,156 @@
+package argo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	sql "github.com/aodin/aspect"
+)
+
+// VersionColumn returns a Modifier that derives the entity tags of the
+// resource from the given column, such as a version counter or an
+// updated_at timestamp. The column must be selected. By default, entity
+// tags are a hash of the entry and its detail includes.
+func VersionColumn(name string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		if !resource.selects.Has(name) {
+			return fmt.Errorf(
+				"argo: cannot use '%s' as a version column, it is not a selected field of '%s'",
+				name,
+				resource.Name,
+			)
+		}
+		resource.version = name
+		return nil
+	})
+}
+
+// RequireIfMatch returns a Modifier that rejects item writes without an
+// If-Match header with a 428 Precondition Required.
+func RequireIfMatch() Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.requireIfMatch = true
+		return nil
+	})
+}
+
+// etag returns the quoted entity tag of the given entry, which must be in
+// the form returned by Get before any hooks have modified it.
+func (c *ResourceSQL) etag(values sql.Values) string {
+	if c.version != "" {
+		switch v := values[c.version].(type) {
+		case time.Time:
+			return fmt.Sprintf(`"%d"`, v.UnixNano())
+		default:
+			return fmt.Sprintf(`"%v"`, v)
+		}
+	}
+
+	return hashETag(values)
+}
+
+// listETag returns the quoted entity tag of a page of results
+func (c *ResourceSQL) listETag(results []sql.Values) string {
+	if c.version == "" {
+		return hashETag(results)
+	}
+	tags := make([]string, len(results))
+	for i, result := range results {
+		tags[i] = c.etag(result)
+	}
+	return hashETag(tags)
+}
+
+// representETag returns the entity tag of the representation of an entry
+// or list with the given tag in the encoding of the request. A strong tag
+// must change with the bytes of the response, so the tag of each encoding
+// includes its media type.
+func representETag(r *Request, tag string) string {
+	if r.Encoding == nil {
+		return tag
+	}
+	return hashETag([]string{tag, r.Encoding.MediaType()})
+}
+
+// setETag sets the entity tag of the response to the representation of the
+// given tag and returns it. Representations are chosen by the Accept
+// header, which is added to the Vary header.
+func setETag(r *Request, tag string) string {
+	tag = representETag(r, tag)
+	header := r.ResponseHeader()
+	header.Set("ETag", tag)
+	header.Set("Vary", "Accept")
+	return tag
+}
+
+// hashETag returns a quoted entity tag from a hash of the given value
+func hashETag(i interface{}) string {
+	// Map keys are sorted by the JSON encoder, so the hash is stable
+	b, err := json.Marshal(i)
+	if err != nil {
+		panic(fmt.Sprintf(
+			"argo: could not JSON encode value for entity tag: %s",
+			err,
+		))
+	}
+	hash := sha1.Sum(b)
+	return `"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+// currentETag returns the entity tag of the representation of an existing
+// entry in the encoding of the request, given all its columns as selected
+// by current
+func (c *ResourceSQL) currentETag(r *Request, conn sql.Connection, old sql.Values) string {
+	if c.version != "" {
+		return representETag(r, c.etag(old))
+	}
+	// Rebuild the representation returned by Get
+	values := sql.Values{}
+	for name := range c.readable(r) {
+		values[name] = old[name]
+	}
+	c.includeDetail(r, conn, values)
+	return representETag(r, c.etag(values))
+}
+
+// checkIfMatch confirms that the If-Match header of the request matches the
+// given existing entry.
+func (c *ResourceSQL) checkIfMatch(r *Request, old sql.Values) *APIError {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if c.requireIfMatch {
+			return MessageError(428, CodePreconditionRequired, nil)
+		}
+		return nil
+	}
+	if !matchETag(header, c.currentETag(r, r.Tx, old), false) {
+		return MessageError(412, CodePreconditionFailed, nil)
+	}
+	return nil
+}
+
+// matchETag reports whether the given tag is matched by the list of tags in
+// an If-Match or If-None-Match header. Weak tags only match when using weak
+// comparison.
+func matchETag(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
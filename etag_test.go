@@ -0,0 +1,120 @@
+package argo
+
+import (
+	"net/http"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchETag(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(true, matchETag(`"a"`, `"a"`, false))
+	assert.Equal(true, matchETag(`"b", "a"`, `"a"`, false))
+	assert.Equal(true, matchETag(`*`, `"a"`, false))
+	assert.Equal(false, matchETag(`"b"`, `"a"`, false))
+
+	// Weak tags only match with weak comparison
+	assert.Equal(false, matchETag(`W/"a"`, `"a"`, false))
+	assert.Equal(true, matchETag(`W/"a"`, `"a"`, true))
+}
+
+func TestResource_AuthorizeBeforePreconditions(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(
+		FromTable(usersDB),
+		RequireIfMatch(),
+		Authorize(PATCH, AllowOwner("id")),
+		Authorize(DELETE, AllowOwner("id")),
+	)
+
+	// Requests that are not allowed never read the entry, which would
+	// panic without a transaction
+	r := MockRequest([]byte(`{"name":"x"}`), nil, 1)
+	r.Header = http.Header{}
+	r.Principal = &Principal{ID: "2"}
+	_, errAPI := users.patch(r)
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	r = MockRequest(nil, nil, 1)
+	r.Header = http.Header{}
+	_, errAPI = users.delete(r)
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+}
+
+func TestResource_IfMatch(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(FromTable(usersDB), RequireIfMatch())
+	users.conn = tx
+
+	response, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"secret"}`), nil,
+	))
+	require.Nil(t, errAPI)
+	uid := response.(sql.Values)["id"].(int64)
+
+	get := MockRequest(nil, nil, uid)
+	_, errAPI = users.Get(get)
+	require.Nil(t, errAPI)
+	etag := get.ResponseHeader().Get("ETag")
+	assert.NotEqual("", etag)
+
+	// Writes without a precondition are rejected
+	_, errAPI = users.Patch(MockRequest([]byte(`{"name":"Q"}`), nil, uid))
+	require.NotNil(t, errAPI)
+	assert.Equal(428, errAPI.code)
+
+	// Writes with a stale tag are rejected
+	patch := MockRequest([]byte(`{"name":"Q"}`), nil, uid)
+	patch.Header = http.Header{"If-Match": []string{`"stale"`}}
+	_, errAPI = users.Patch(patch)
+	require.NotNil(t, errAPI)
+	assert.Equal(412, errAPI.code)
+
+	patch = MockRequest([]byte(`{"name":"Q"}`), nil, uid)
+	patch.Header = http.Header{"If-Match": []string{etag}}
+	_, errAPI = users.Patch(patch)
+	require.Nil(t, errAPI)
+
+	// The previous tag is now stale
+	assert.NotEqual(etag, patch.ResponseHeader().Get("ETag"))
+	remove := MockRequest(nil, nil, uid)
+	remove.Header = http.Header{"If-Match": []string{etag}}
+	_, errAPI = users.Delete(remove)
+	require.NotNil(t, errAPI)
+	assert.Equal(412, errAPI.code)
+}
+
+func TestSetETag(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(FromTable(usersDB), VersionColumn("id"))
+	result := sql.Values{"id": int64(1)}
+
+	// Each encoding of an entry has its own strong tag
+	asJSON := MockRequest(nil, nil, 1)
+	asJSON.Encoding = JSON{}
+	asCSV := MockRequest(nil, nil, 1)
+	asCSV.Encoding = CSV{}
+
+	jsonTag := setETag(asJSON, users.etag(result))
+	csvTag := setETag(asCSV, users.etag(result))
+	assert.NotEqual(jsonTag, csvTag)
+	assert.Equal(jsonTag, asJSON.ResponseHeader().Get("ETag"))
+	assert.Equal("Accept", asJSON.ResponseHeader().Get("Vary"))
+
+	// Preconditions compare against the tag of the request's encoding
+	assert.Equal(jsonTag, users.currentETag(asJSON, nil, result))
+	assert.Equal(true, matchETag(jsonTag, users.currentETag(asJSON, nil, result), false))
+	assert.Equal(false, matchETag(jsonTag, users.currentETag(asCSV, nil, result), false))
+}
@@ -0,0 +1,451 @@
+package argo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	sql "github.com/aodin/aspect"
+)
+
+// Change identifies an entry of a resource that was created, changed or
+// deleted. Deleted entries carry the values they had, since they can no
+// longer be selected.
+type Change struct {
+	PK      interface{}
+	Deleted sql.Values // Nil unless the entry was deleted
+}
+
+// Notifier delivers the changes of entries to the subscribers of their
+// resource
+type Notifier interface {
+	Notify(resource string, change Change)
+	Subscribe(resource string) (changes <-chan Change, cancel func())
+}
+
+// LocalNotifier is an in-process Notifier. It only reaches subscribers of
+// the same process, and drops the changes of subscribers that are too far
+// behind.
+type LocalNotifier struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Change]bool
+}
+
+// Notify sends the change to every subscriber of the resource
+func (n *LocalNotifier) Notify(resource string, change Change) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for changes := range n.subscribers[resource] {
+		select {
+		case changes <- change:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the changes of the resource until it is cancelled
+func (n *LocalNotifier) Subscribe(resource string) (<-chan Change, func()) {
+	changes := make(chan Change, 64)
+	n.mu.Lock()
+	if n.subscribers[resource] == nil {
+		n.subscribers[resource] = make(map[chan Change]bool)
+	}
+	n.subscribers[resource][changes] = true
+	n.mu.Unlock()
+
+	var once sync.Once
+	return changes, func() {
+		once.Do(func() {
+			n.mu.Lock()
+			delete(n.subscribers[resource], changes)
+			n.mu.Unlock()
+		})
+	}
+}
+
+// NewLocalNotifier creates an empty LocalNotifier
+func NewLocalNotifier() *LocalNotifier {
+	return &LocalNotifier{
+		subscribers: make(map[string]map[chan Change]bool),
+	}
+}
+
+// EventsElem is the internal representation of the event stream mode of
+// lists. Requests that accept text/event-stream first receive the current
+// page of the list as "result" events, followed by a "ready" event, and
+// then a "change" event for every entry that is created or changed
+// afterwards and matches the filters of the request.
+//
+// Changes come from a Notifier, which is sent the entries that the
+// resource writes, or by polling a column that increases with every
+// write, such as updated_at. Notifiers also send a "delete" event with the
+// primary key of every entry within the scope of the request that is
+// deleted or soft deleted, whether or not it matched the filters; polling
+// cannot see deletes. Restored entries are sent as changes.
+type EventsElem struct {
+	notifier  Notifier
+	column    string
+	interval  time.Duration
+	heartbeat time.Duration
+}
+
+// Notify sets the Notifier of changes
+func (elem EventsElem) Notify(notifier Notifier) EventsElem {
+	elem.notifier = notifier
+	return elem
+}
+
+// Poll selects the entries whose column has increased at every interval
+func (elem EventsElem) Poll(column string, interval time.Duration) EventsElem {
+	elem.column = column
+	elem.interval = interval
+	return elem
+}
+
+// Heartbeat sets the interval of the comments that keep idle streams open
+func (elem EventsElem) Heartbeat(interval time.Duration) EventsElem {
+	elem.heartbeat = interval
+	return elem
+}
+
+// Modify implements the Modifier interface
+func (elem EventsElem) Modify(resource *ResourceSQL) error {
+	if elem.notifier == nil && elem.column == "" {
+		return fmt.Errorf(
+			"argo: the event stream of %s needs a notifier or a polled column",
+			resource.Name,
+		)
+	}
+	if elem.column != "" {
+		if !resource.selects.Has(elem.column) {
+			return fmt.Errorf(
+				"argo: cannot poll '%s', it is not a selected field of '%s'",
+				elem.column,
+				resource.Name,
+			)
+		}
+		if elem.interval <= 0 {
+			return fmt.Errorf(
+				"argo: the poll interval of %s must be positive",
+				resource.Name,
+			)
+		}
+	}
+	if elem.heartbeat <= 0 {
+		return fmt.Errorf(
+			"argo: the heartbeat interval of %s must be positive",
+			resource.Name,
+		)
+	}
+	if resource.events != nil {
+		return fmt.Errorf(
+			"argo: the resource %s already has an event stream",
+			resource.Name,
+		)
+	}
+	resource.events = &elem
+
+	if elem.notifier != nil {
+		key := resource.table.PrimaryKey()[0]
+		notify := func(r *Request, values sql.Values) *APIError {
+			change := Change{PK: values[key]}
+			r.onCommit(func() { elem.notifier.Notify(resource.Name, change) })
+			return nil
+		}
+		resource.hooks.afterCreate = append(resource.hooks.afterCreate, notify)
+		resource.hooks.afterUpdate = append(
+			resource.hooks.afterUpdate,
+			func(r *Request, old, new sql.Values) *APIError {
+				return notify(r, old)
+			},
+		)
+		resource.hooks.afterDelete = append(
+			resource.hooks.afterDelete,
+			func(r *Request, old sql.Values) *APIError {
+				change := Change{PK: old[key], Deleted: old}
+				r.onCommit(func() { elem.notifier.Notify(resource.Name, change) })
+				return nil
+			},
+		)
+	}
+	return nil
+}
+
+// Events creates a new event stream mode with a heartbeat every 15 seconds
+func Events() EventsElem {
+	return EventsElem{heartbeat: 15 * time.Second}
+}
+
+// SSE implements the encoding of Server-Sent Events. Responses other than
+// event streams are sent as a single "message" event.
+type SSE struct{}
+
+func (c SSE) Encode(i interface{}) []byte {
+	var buffer bytes.Buffer
+	if err := c.EncodeTo(&buffer, i); err != nil {
+		panic(fmt.Sprintf("argo: could not SSE encode response: %s", err))
+	}
+	return buffer.Bytes()
+}
+
+// EncodeTo implements the StreamEncoder interface. The rows of streams are
+// sent as "result" events.
+func (c SSE) EncodeTo(w io.Writer, i interface{}) error {
+	stream, ok := i.(StreamResponse)
+	if !ok {
+		return c.writeEvent(w, "message", i)
+	}
+	for {
+		row, err := stream.Rows.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		if err = c.writeEvent(w, "result", row); err != nil {
+			return err
+		}
+	}
+}
+
+// writeEvent writes a single event with JSON encoded data
+func (c SSE) writeEvent(w io.Writer, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+func (c SSE) MediaType() string {
+	return "text/event-stream"
+}
+
+// EventStream is the response to list requests that accept event streams.
+// It is written by the API until the client disconnects.
+type EventStream struct {
+	StreamResponse
+	follow func(w io.Writer, done <-chan struct{}) error
+}
+
+// eventStream subscribes to the changes of the list before its current
+// page is selected, so that no change is missed in between
+func (c *ResourceSQL) eventStream(r *Request, meta Meta, filters []sql.Clause) (Response, *APIError) {
+	if c.events == nil {
+		return nil, MessageError(
+			400,
+			CodeUnsupportedFormat,
+			map[string]interface{}{"format": SSE{}.MediaType()},
+		)
+	}
+
+	var changes <-chan Change
+	cancel := func() {}
+	if c.events.notifier != nil {
+		changes, cancel = c.events.notifier.Subscribe(c.Name)
+	}
+	var since sql.Values
+	if c.events.column != "" {
+		since = c.latest(filters)
+	}
+
+	response, apiErr := c.streamList(r, meta, filters)
+	if apiErr != nil {
+		cancel()
+		return nil, apiErr
+	}
+	stream := response.(StreamResponse)
+	stream.close = func() error {
+		cancel()
+		return nil
+	}
+
+	follow := func(w io.Writer, done <-chan struct{}) error {
+		return c.follow(r, filters, changes, since, w, done)
+	}
+	return EventStream{StreamResponse: stream, follow: follow}, nil
+}
+
+// pollKeys are the order of polled changes: the polled column, then the
+// primary key, so that entries written with the same value of the column
+// are told apart
+func (c *ResourceSQL) pollKeys() []sortKey {
+	return c.stableSort([]sortKey{{column: c.table.C[c.events.column]}})
+}
+
+// latest returns the polled column and primary key of the last entry of
+// the list in the order of polling, or nil if it is empty
+func (c *ResourceSQL) latest(filters []sql.Clause) sql.Values {
+	keys := c.pollKeys()
+	selects := make([]sql.Selectable, len(keys))
+	order := make([]sql.Orderable, len(keys))
+	for i, key := range keys {
+		selects[i] = key.column
+		order[i] = key.column.Desc()
+	}
+	clauses := append([]sql.Clause{keys[0].column.IsNotNull()}, filters...)
+	stmt := sql.Select(selects...).Where(
+		sql.AllOf(clauses...),
+	).OrderBy(order...).Limit(1)
+
+	since := sql.Values{}
+	dbErr := c.conn.QueryOne(stmt, since)
+	if dbErr == sql.ErrNoResult {
+		return nil
+	}
+	if dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not query the latest change in sql resource (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+	return since
+}
+
+// follow writes a "change" event for every change to the list until done
+func (c *ResourceSQL) follow(r *Request, filters []sql.Clause, changes <-chan Change, since sql.Values, w io.Writer, done <-chan struct{}) error {
+	heartbeat := time.NewTicker(c.events.heartbeat)
+	defer heartbeat.Stop()
+
+	var poll <-chan time.Time
+	if c.events.column != "" {
+		ticker := time.NewTicker(c.events.interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	key := c.table.PrimaryKey()[0]
+	for {
+		// Copy the filters, since each change adds its own clause
+		clauses := append([]sql.Clause{}, filters...)
+		var rows []sql.Values
+		select {
+		case <-done:
+			return nil
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			continue
+		case change := <-changes:
+			if change.Deleted != nil {
+				if !c.inScope(r, change.Deleted) {
+					continue
+				}
+				deleted := sql.Values{key: change.PK}
+				if err := (SSE{}).writeEvent(w, "delete", deleted); err != nil {
+					return err
+				}
+				continue
+			}
+			clauses = append(clauses, c.table.C[key].Equals(change.PK))
+			rows = c.changed(r, clauses)
+		case <-poll:
+			keys := c.pollKeys()
+			clauses = append(clauses, keys[0].column.IsNotNull())
+			if since != nil {
+				clauses = append(clauses, after(keys, since))
+			}
+			rows = c.changed(r, clauses)
+			if len(rows) > 0 {
+				last := rows[len(rows)-1]
+				since = sql.Values{}
+				for _, k := range keys {
+					since[k.column.Name()] = last[k.column.Name()]
+				}
+			}
+		}
+
+		readable := c.readable(r)
+		for _, row := range rows {
+			if apiErr := runHooks(c.hooks.afterRead, r, row); apiErr != nil {
+				return apiErr
+			}
+			for _, name := range []string{c.events.column, key} {
+				if name != "" && !readable.Has(name) {
+					delete(row, name)
+				}
+			}
+			if err := (SSE{}).writeEvent(w, "change", row); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// changed selects the readable columns of the changed entries. The polled
+// column and primary key are always selected, and entries are ordered by
+// them.
+func (c *ResourceSQL) changed(r *Request, clauses []sql.Clause) []sql.Values {
+	selects := Columns{}
+	for name, column := range c.readable(r) {
+		selects[name] = column
+	}
+	var order []sql.Orderable
+	if c.events.column != "" {
+		for _, key := range c.pollKeys() {
+			selects[key.column.Name()] = key.column
+		}
+		order = orderBy(c.pollKeys())
+	}
+	stmt := sql.Select(selects).Where(sql.AllOf(clauses...)).OrderBy(order...)
+
+	results := make([]sql.Values, 0)
+	if dbErr := c.conn.QueryAll(stmt, &results); dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not query changes in sql resource (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+	FixValues(results...)
+	for _, include := range c.listIncludes {
+		if dbErr := queryAllIncludes(include, r, c.conn, results); dbErr != nil {
+			panic(fmt.Sprintf(
+				"argo: could not query all includes in sql resource changes: %s",
+				dbErr,
+			))
+		}
+	}
+	return results
+}
+
+// inScope reports whether the values of an entry are within the scope of
+// the request
+func (c *ResourceSQL) inScope(r *Request, values sql.Values) bool {
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return false
+	}
+	for name, value := range scope {
+		if fmt.Sprint(values[name]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeEvents writes the current page of the event stream, then its
+// changes until the client disconnects
+func writeEvents(w http.ResponseWriter, request *Request, events EventStream) {
+	defer events.Close()
+	w.Header().Set("Content-Type", SSE{}.MediaType())
+	w.Header().Set("Cache-Control", "no-cache")
+	fw := flushWriter{w: w}
+
+	// Headers have been written, so errors can only end the stream
+	if err := (SSE{}).EncodeTo(fw, events.StreamResponse); err != nil {
+		return
+	}
+	if err := (SSE{}).writeEvent(fw, "ready", events.Meta); err != nil {
+		return
+	}
+	events.follow(fw, request.Context().Done())
+}
@@ -0,0 +1,199 @@
+package argo
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := NewLocalNotifier()
+	changes, cancel := notifier.Subscribe("users")
+	notifier.Notify("users", Change{PK: int64(1)})
+	notifier.Notify("posts", Change{PK: int64(2)})
+	assert.Equal(Change{PK: int64(1)}, <-changes)
+	assert.Equal(0, len(changes))
+
+	// Slow subscribers do not block
+	for i := 0; i < 100; i++ {
+		notifier.Notify("users", Change{PK: i})
+	}
+	assert.Equal(64, len(changes))
+
+	cancel()
+	cancel()
+	assert.Equal(0, len(notifier.subscribers["users"]))
+}
+
+func TestNDJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	response := MultiResponse{
+		Results: []sql.Values{{"id": int64(1)}, {"id": int64(2)}},
+	}
+	assert.Equal("{\"id\":1}\n{\"id\":2}\n", string(NDJSON{}.Encode(response)))
+	assert.Equal("{\"a\":\"b\"}\n", string(NDJSON{}.Encode(map[string]string{"a": "b"})))
+}
+
+func TestResourceSQL_InScope(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(
+		FromTable(usersDB),
+		Scope(func(r *Request) (sql.Values, *APIError) {
+			return sql.Values{"age": 1}, nil
+		}),
+	)
+	r := MockRequest(nil, nil)
+	assert.Equal(true, users.inScope(r, sql.Values{"id": int64(1), "age": int64(1)}))
+	assert.Equal(false, users.inScope(r, sql.Values{"id": int64(1), "age": int64(2)}))
+
+	unscoped := Resource(FromTable(usersDB))
+	assert.Equal(true, unscoped.inScope(r, sql.Values{"age": int64(2)}))
+}
+
+func TestResource_PollEvents(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(
+		FromTable(usersDB),
+		Events().Poll("created", 10*time.Millisecond),
+	)
+	users.conn = tx
+
+	post := func(name string) {
+		_, errAPI := users.Post(MockRequest(
+			[]byte(`{"name":"`+name+`","age":1,"password":"x"}`), nil,
+		))
+		require.Nil(t, errAPI)
+	}
+	post("a")
+
+	r := MockRequest(nil, nil)
+	r.Encoding = SSE{}
+	response, errAPI := users.List(r)
+	require.Nil(t, errAPI)
+	events := response.(EventStream)
+	defer events.Close()
+
+	// Entries of the transaction share the timestamp of the last one seen,
+	// and are told apart by their primary key
+	post("b")
+	w := &eventRecorder{done: make(chan struct{})}
+	timeout := time.AfterFunc(5*time.Second, w.stop)
+	defer timeout.Stop()
+	require.Nil(t, events.follow(w, w.done))
+	assert.Equal(true, strings.Contains(w.String(), `"name":"b"`))
+	assert.Equal(false, strings.Contains(w.String(), `"name":"a"`))
+}
+
+func TestSSE(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		"event: message\ndata: {\"a\":\"b\"}\n\n",
+		string(SSE{}.Encode(map[string]string{"a": "b"})),
+	)
+	stream := StreamResponse{
+		Rows: &valuesRows{rows: []sql.Values{{"id": int64(1)}}},
+	}
+	assert.Equal(
+		"event: result\ndata: {\"id\":1}\n\n",
+		string(SSE{}.Encode(stream)),
+	)
+}
+
+// eventRecorder ends an event stream after its first event of the given
+// type, which defaults to change
+type eventRecorder struct {
+	bytes.Buffer
+	event string
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (w *eventRecorder) Write(b []byte) (int, error) {
+	event := w.event
+	if event == "" {
+		event = "change"
+	}
+	if strings.HasPrefix(string(b), "event: "+event) {
+		w.stop()
+	}
+	return w.Buffer.Write(b)
+}
+
+func (w *eventRecorder) stop() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func TestResource_Events(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	notifier := NewLocalNotifier()
+	users := Resource(
+		FromTable(usersDB),
+		WriteOnly("password"),
+		Events().Notify(notifier),
+	)
+	users.conn = tx
+
+	post := func(name string) {
+		_, errAPI := users.Post(MockRequest(
+			[]byte(`{"name":"`+name+`","age":1,"password":"x"}`), nil,
+		))
+		require.Nil(t, errAPI)
+	}
+	post("a")
+
+	r := MockRequest(nil, url.Values{"age": []string{"1"}})
+	r.Encoding = SSE{}
+	response, errAPI := users.List(r)
+	require.Nil(t, errAPI)
+	events := response.(EventStream)
+	defer events.Close()
+
+	page, err := events.buffer()
+	require.Nil(t, err)
+	assert.Equal(1, len(page.Results.([]sql.Values)))
+
+	// Changes are sent once they are committed
+	post("b")
+	w := &eventRecorder{done: make(chan struct{})}
+	timeout := time.AfterFunc(5*time.Second, w.stop)
+	defer timeout.Stop()
+	require.Nil(t, events.follow(w, w.done))
+	assert.Equal(true, strings.Contains(w.String(), `"name":"b"`))
+	assert.Equal(false, strings.Contains(w.String(), "password"))
+
+	// Deletes are sent with the primary key of the entry
+	_, errAPI = users.Delete(MockRequest(nil, nil, 1))
+	require.Nil(t, errAPI)
+	w = &eventRecorder{event: "delete", done: make(chan struct{})}
+	timeout = time.AfterFunc(5*time.Second, w.stop)
+	defer timeout.Stop()
+	require.Nil(t, events.follow(w, w.done))
+	assert.Equal(true, strings.Contains(w.String(), "event: delete\ndata: {\"id\":1}"))
+
+	// Resources without events cannot stream them
+	plain := Resource(FromTable(usersDB))
+	plain.conn = tx
+	_, errAPI = plain.List(r)
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+}
@@ -0,0 +1,374 @@
+package argo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	sql "github.com/aodin/aspect"
+)
+
+// Rows iterates over the results of a response. Next returns nil values
+// once there are no more rows.
+type Rows interface {
+	Next() (sql.Values, error)
+}
+
+// RowWriter is implemented by encoders that can write rows as they are
+// read, without holding all of them in memory
+type RowWriter interface {
+	WriteRows(w io.Writer, fields []string, rows Rows) error
+}
+
+// valuesRows iterates over rows that are already in memory
+type valuesRows struct {
+	rows []sql.Values
+}
+
+func (v *valuesRows) Next() (sql.Values, error) {
+	if len(v.rows) == 0 {
+		return nil, nil
+	}
+	row := v.rows[0]
+	v.rows = v.rows[1:]
+	return row, nil
+}
+
+// Export is a response whose rows are streamed from a database cursor by
+// an encoder that implements RowWriter. It is returned by the List method
+// of ResourceSQL when the request has ?export=true.
+type Export struct {
+	Fields []string
+	Rows   Rows
+}
+
+// exportBatch is the number of rows that are selected, and that includes
+// and hooks are run for, at once during exports
+const exportBatch = 500
+
+// cursorRows reads the rows of a list in batches. Each batch is a query of
+// its own that is closed before the includes of its rows are queried,
+// since a connection cannot run queries while it is reading the rows of
+// another. Batches after the first select the rows that sort after the
+// last row read, rather than using an offset, so each batch is an index
+// seek and rows written between batches are neither skipped nor repeated.
+type cursorRows struct {
+	r       *Request
+	c       *ResourceSQL
+	columns []sql.ColumnElem
+	keys    []sortKey
+	filters []sql.Clause
+	offset  int // Only skipped by the first batch
+	limit   int // Zero reads every row
+	read    int
+	last    sql.Values // The keys of the last row read
+	done    bool
+	batch   []sql.Values
+}
+
+func (rows *cursorRows) Next() (sql.Values, error) {
+	if len(rows.batch) == 0 {
+		if err := rows.fill(); err != nil {
+			return nil, err
+		}
+		if len(rows.batch) == 0 {
+			return nil, nil
+		}
+	}
+	row := rows.batch[0]
+	rows.batch = rows.batch[1:]
+	return row, nil
+}
+
+// fill selects the next batch of rows and adds their includes
+func (rows *cursorRows) fill() error {
+	size := exportBatch
+	if rows.limit > 0 && rows.limit-rows.read < size {
+		size = rows.limit - rows.read
+	}
+	if rows.done || size <= 0 {
+		rows.done = true
+		return nil
+	}
+	batch := rows.scan(size)
+	rows.read += len(batch)
+	if len(batch) < size {
+		rows.done = true
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	FixValues(batch...)
+
+	for _, include := range rows.c.listIncludes {
+		if dbErr := queryAllIncludes(include, rows.r, rows.c.conn, batch); dbErr != nil {
+			panic(fmt.Sprintf(
+				"argo: could not query all includes in sql resource export: %s",
+				dbErr,
+			))
+		}
+	}
+	if apiErr := runHooks(rows.c.hooks.afterRead, rows.r, batch...); apiErr != nil {
+		return apiErr
+	}
+	rows.batch = batch
+	return nil
+}
+
+// scan selects at most the given number of rows after those already read.
+// Key columns that are not fields are selected too, but only kept as the
+// position of the cursor.
+func (rows *cursorRows) scan(size int) []sql.Values {
+	selects := make([]sql.Selectable, 0, len(rows.columns)+len(rows.keys))
+	for _, column := range rows.columns {
+		selects = append(selects, column)
+	}
+	var extra []sql.ColumnElem
+	for _, key := range rows.keys {
+		if !hasColumn(rows.columns, key.column) && !hasColumn(extra, key.column) {
+			extra = append(extra, key.column)
+			selects = append(selects, key.column)
+		}
+	}
+
+	clauses := append([]sql.Clause{}, rows.filters...)
+	stmt := sql.Select(selects...)
+	if rows.last == nil {
+		stmt = stmt.Offset(rows.offset)
+	} else if clause := after(rows.keys, rows.last); clause != nil {
+		clauses = append(clauses, clause)
+	} else {
+		// No row sorts after the last one
+		return nil
+	}
+	if len(clauses) > 0 {
+		stmt = stmt.Where(sql.AllOf(clauses...))
+	}
+	stmt = stmt.OrderBy(orderBy(rows.keys)...).Limit(size)
+
+	result, err := rows.c.conn.Query(stmt)
+	if err != nil {
+		panic(fmt.Sprintf(
+			"argo: could not query sql resource export (%s): %s",
+			stmt,
+			err,
+		))
+	}
+	defer result.Close()
+
+	batch := make([]sql.Values, 0, size)
+	for result.Next() {
+		dests := make([]interface{}, len(selects))
+		pointers := make([]interface{}, len(selects))
+		for i := range dests {
+			pointers[i] = &dests[i]
+		}
+		if err := result.Scan(pointers...); err != nil {
+			panic(fmt.Sprintf(
+				"argo: could not scan a row in sql resource export: %s",
+				err,
+			))
+		}
+		row := sql.Values{}
+		for i, column := range rows.columns {
+			row[column.Name()] = dests[i]
+		}
+		// Keep the keys as scanned, before they are fixed or hooked
+		last := sql.Values{}
+		for i, column := range append(rows.columns, extra...) {
+			last[column.Name()] = dests[i]
+		}
+		rows.last = last
+		batch = append(batch, row)
+	}
+	return batch
+}
+
+// hasColumn returns true if the column is one of the given columns
+func hasColumn(columns []sql.ColumnElem, column sql.ColumnElem) bool {
+	for _, c := range columns {
+		if c.Name() == column.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// after returns a clause that matches the rows that sort after the given
+// row by the keys, or nil if no row can. NULLs sort after every value in
+// ascending order and before them in descending order, as they do in
+// PostgreSQL.
+func after(keys []sortKey, last sql.Values) sql.Clause {
+	var alternatives, equal []sql.Clause
+	for _, key := range keys {
+		value := last[key.column.Name()]
+		var beyond, same sql.Clause
+		switch {
+		case value == nil && key.desc:
+			beyond, same = key.column.IsNotNull(), key.column.IsNull()
+		case value == nil:
+			same = key.column.IsNull()
+		case key.desc:
+			beyond, same = key.column.LessThan(value), key.column.Equals(value)
+		default:
+			beyond = sql.AnyOf(key.column.GreaterThan(value), key.column.IsNull())
+			same = key.column.Equals(value)
+		}
+		if beyond != nil {
+			clauses := append(append([]sql.Clause{}, equal...), beyond)
+			alternatives = append(alternatives, sql.AllOf(clauses...))
+		}
+		equal = append(equal, same)
+	}
+	if len(alternatives) == 0 {
+		return nil
+	}
+	return sql.AnyOf(alternatives...)
+}
+
+// cursor iterates over the rows of the list in batches, starting at the
+// offset and reading at most limit rows, or all of them if the limit is
+// zero. The columns are selected explicitly so that rows can be scanned
+// in the order of the fields.
+func (c *ResourceSQL) cursor(r *Request, fields []string, meta Meta, filters []sql.Clause, offset, limit int) *cursorRows {
+	columns := make([]sql.ColumnElem, len(fields))
+	for i, name := range fields {
+		columns[i] = c.table.C[name]
+	}
+	return &cursorRows{
+		r:       r,
+		c:       c,
+		columns: columns,
+		keys:    c.stableSort(meta.sort),
+		filters: filters,
+		offset:  offset,
+		limit:   limit,
+	}
+}
+
+// stableSort appends the primary keys to the sort keys, so that every row
+// has a distinct position in the order of a cursor
+func (c *ResourceSQL) stableSort(keys []sortKey) []sortKey {
+	stable := append([]sortKey{}, keys...)
+	for _, pk := range c.table.PrimaryKey() {
+		stable = append(stable, sortKey{column: c.table.C[pk]})
+	}
+	return stable
+}
+
+// extensions are the file extensions of exports by media type
+var extensions = map[string]string{
+	"text/csv":             "csv",
+	"application/json":     "json",
+	"application/x-ndjson": "ndjson",
+}
+
+// fieldOrder returns the names of the columns the request may read, in the
+// order of the resource table
+func (c *ResourceSQL) fieldOrder(r *Request) []string {
+	selects := c.readable(r)
+	fields := make([]string, 0, len(selects))
+	for _, column := range c.table.Columns() {
+		if selects.Has(column.Name()) {
+			fields = append(fields, column.Name())
+		}
+	}
+	return fields
+}
+
+// includeName returns the field of the rows that an include is added
+// as, or false if it is not a Many or ManyToMany include
+func includeName(include Include) (string, bool) {
+	switch elem := include.(type) {
+	case ManyElem:
+		return elem.name, true
+	case ManyToManyElem:
+		return elem.name, true
+	}
+	return "", false
+}
+
+// includeFields returns the sorted fields of the rows of a Many or
+// ManyToMany include, or nil if they are not known until the include is
+// queried, as with AsMap
+func includeFields(include Include) []string {
+	var selects Columns
+	var fk string
+	switch elem := include.(type) {
+	case ManyElem:
+		if elem.asMap != nil {
+			return nil
+		}
+		selects = elem.selects
+		if !elem.showFK {
+			fk = elem.fk.Name()
+		}
+	case ManyToManyElem:
+		selects = elem.selects
+		if !elem.showFK {
+			fk = elem.resourceFK.Name()
+		}
+	}
+	fields := make([]string, 0, len(selects))
+	for name := range selects {
+		if name != fk {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// rowFields returns the fields of the rows of lists: the given columns,
+// followed by the list includes in the order they were added. CSV
+// flattens includes into a column per included field, named
+// include.field, or leaves them out if it drops them.
+func (c *ResourceSQL) rowFields(r *Request, columns []string) []string {
+	encoder, csv := r.Encoding.(CSV)
+	if csv && encoder.DropIncludes {
+		return columns
+	}
+	fields := append([]string{}, columns...)
+	for _, include := range c.listIncludes {
+		name, ok := includeName(include)
+		if !ok {
+			continue
+		}
+		if !csv {
+			fields = append(fields, name)
+			continue
+		}
+		// Fields of AsMap includes follow from the first row
+		for _, field := range includeFields(include) {
+			fields = append(fields, name+"."+field)
+		}
+	}
+	return fields
+}
+
+// export streams every row of the list, ignoring the limit and offset
+func (c *ResourceSQL) export(r *Request, meta Meta, filters []sql.Clause) (Response, *APIError) {
+	if _, ok := r.Encoding.(RowWriter); !ok {
+		return nil, MessageError(
+			400,
+			CodeUnsupportedFormat,
+			map[string]interface{}{"format": r.Encoding.MediaType()},
+		)
+	}
+
+	fields := c.fieldOrder(r)
+	rows := c.cursor(r, fields, meta, filters, 0, 0)
+
+	filename := c.Name
+	if extension, exists := extensions[r.Encoding.MediaType()]; exists {
+		filename += "." + extension
+	}
+	r.ResponseHeader().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s"`, filename),
+	)
+	return Export{
+		Fields: c.rowFields(r, fields),
+		Rows:   rows,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package argo
+
+import (
+	sql "github.com/aodin/aspect"
+)
+
+// Hook is called with the values of a single entry. Hooks may modify the
+// values in place or return an error to abort the request. Hooks of write
+// requests run inside the request transaction, see Request.Tx.
+type Hook func(*Request, sql.Values) *APIError
+
+// UpdateHook is called with both the existing values of an entry and the
+// new values that are being written.
+type UpdateHook func(r *Request, old, new sql.Values) *APIError
+
+type hooks struct {
+	beforeCreate []Hook
+	afterCreate  []Hook
+	beforeUpdate []UpdateHook
+	afterUpdate  []UpdateHook
+	beforeDelete []Hook
+	afterDelete  []Hook
+	afterRead    []Hook
+}
+
+// ModifierFunc allows an ordinary function to be used as a Modifier.
+type ModifierFunc func(*ResourceSQL) error
+
+// Modify calls the function with the given resource
+func (f ModifierFunc) Modify(resource *ResourceSQL) error {
+	return f(resource)
+}
+
+// BeforeCreate adds hooks that are called with the validated values of a
+// POST before they are inserted.
+func BeforeCreate(fns ...Hook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.beforeCreate = append(resource.hooks.beforeCreate, fns...)
+		return nil
+	})
+}
+
+// AfterCreate adds hooks that are called with the created entry.
+func AfterCreate(fns ...Hook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.afterCreate = append(resource.hooks.afterCreate, fns...)
+		return nil
+	})
+}
+
+// BeforeUpdate adds hooks that are called with the existing entry and the
+// validated values of a PATCH before the entry is updated.
+func BeforeUpdate(fns ...UpdateHook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.beforeUpdate = append(resource.hooks.beforeUpdate, fns...)
+		return nil
+	})
+}
+
+// AfterUpdate adds hooks that are called with the previous and updated
+// values of an entry.
+func AfterUpdate(fns ...UpdateHook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.afterUpdate = append(resource.hooks.afterUpdate, fns...)
+		return nil
+	})
+}
+
+// BeforeDelete adds hooks that are called with the entry that is about to
+// be deleted.
+func BeforeDelete(fns ...Hook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.beforeDelete = append(resource.hooks.beforeDelete, fns...)
+		return nil
+	})
+}
+
+// AfterDelete adds hooks that are called with the deleted entry.
+func AfterDelete(fns ...Hook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.afterDelete = append(resource.hooks.afterDelete, fns...)
+		return nil
+	})
+}
+
+// AfterRead adds hooks that are called with every entry before it is sent
+// to the client, including the results of writes.
+func AfterRead(fns ...Hook) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.hooks.afterRead = append(resource.hooks.afterRead, fns...)
+		return nil
+	})
+}
+
+// runHooks calls each hook in order and stops at the first error
+func runHooks(fns []Hook, r *Request, values ...sql.Values) *APIError {
+	for _, value := range values {
+		for _, fn := range fns {
+			if err := fn(r, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runUpdateHooks calls each update hook in order and stops at the first error
+func runUpdateHooks(fns []UpdateHook, r *Request, old, new sql.Values) *APIError {
+	for _, fn := range fns {
+		if err := fn(r, old, new); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package argo
+
+import (
+	"strings"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	var previous string
+	var deleted int64
+
+	users := Resource(
+		FromTable(usersDB),
+		BeforeCreate(func(r *Request, values sql.Values) *APIError {
+			if values["name"] == "root" {
+				return MetaError(403, "root cannot be created")
+			}
+			values["password"] = strings.ToUpper(values["password"].(string))
+			return nil
+		}),
+		BeforeUpdate(func(r *Request, old, new sql.Values) *APIError {
+			previous = old["name"].(string)
+			return nil
+		}),
+		AfterDelete(func(r *Request, values sql.Values) *APIError {
+			deleted = values["id"].(int64)
+			return nil
+		}),
+		AfterRead(func(r *Request, values sql.Values) *APIError {
+			values["read"] = true
+			return nil
+		}),
+	)
+	users.conn = tx
+
+	var errAPI *APIError
+
+	// Hooks can abort the request
+	_, errAPI = users.Post(MockRequest(
+		[]byte(`{"name":"root","age":1,"password":"secret"}`), nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+
+	// Hooks can modify values before they are inserted
+	response, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"secret"}`), nil,
+	))
+	require.Nil(t, errAPI)
+	result := response.(sql.Values)
+	assert.Equal("SECRET", result["password"])
+	assert.Equal(true, result["read"])
+
+	uid := result["id"].(int64)
+	_, errAPI = users.Patch(MockRequest([]byte(`{"name":"Q"}`), nil, uid))
+	require.Nil(t, errAPI)
+	assert.Equal("admin", previous)
+
+	_, errAPI = users.Delete(MockRequest(nil, nil, uid))
+	require.Nil(t, errAPI)
+	assert.Equal(uid, deleted)
+}
@@ -0,0 +1,482 @@
+package argo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+	"github.com/aodin/aspect/postgres"
+)
+
+// ImportElem is the internal representation of a bulk import endpoint. It
+// adds the collection action POST /<name>/import, which accepts a CSV file
+// with a header row or newline-delimited JSON, one object per line.
+//
+// Every record goes through the same validation as Post. If any record is
+// invalid nothing is written, and the error fields are keyed by line and
+// field, such as "3.name". The query parameter dry_run=true only validates
+// the records; since before hooks may have side effects, they are not
+// called by dry runs. The query parameter mode=upsert updates the entries
+// that match a record by the upsert key instead of creating new ones.
+type ImportElem struct {
+	upsert    []string
+	batchSize int
+}
+
+// Upsert sets the columns of the unique constraint that matches records
+// to existing entries when imports are made with mode=upsert
+func (elem ImportElem) Upsert(columns ...string) ImportElem {
+	elem.upsert = columns
+	return elem
+}
+
+// BatchSize sets the number of rows written by each insert statement
+func (elem ImportElem) BatchSize(size int) ImportElem {
+	elem.batchSize = size
+	return elem
+}
+
+// Modify implements the Modifier interface. Modifiers that add uniqueness
+// rules must be given before an import with an upsert key.
+func (elem ImportElem) Modify(resource *ResourceSQL) error {
+	if elem.batchSize < 1 {
+		return fmt.Errorf(
+			"argo: the import batch size of %s must be positive",
+			resource.Name,
+		)
+	}
+	if len(elem.upsert) > 0 && resource.uniqueRule(elem.upsert) == nil {
+		return fmt.Errorf(
+			"argo: cannot upsert imports of %s by (%s), it is not unique",
+			resource.Name,
+			strings.Join(elem.upsert, ", "),
+		)
+	}
+	return Action{
+		Method: string(POST),
+		Name:   "import",
+		Handler: func(r *Request) (Response, *APIError) {
+			return resource.importRecords(r, elem)
+		},
+	}.Modify(resource)
+}
+
+// Import creates a new bulk import endpoint
+func Import() ImportElem {
+	return ImportElem{batchSize: 500}
+}
+
+// ImportResult is the response of a successful import
+type ImportResult struct {
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	DryRun  bool `json:"dry_run"`
+}
+
+// importRecord is a single record of an import and, for upserts, the
+// existing entry it matches
+type importRecord struct {
+	line   int
+	values sql.Values
+	old    sql.Values
+}
+
+// uniqueRule returns the uniqueness rule of the given columns, if any
+func (c *ResourceSQL) uniqueRule(columns []string) *UniqueElem {
+	for i, unique := range c.uniques {
+		if sameColumns(unique.columns, columns) {
+			return &c.uniques[i]
+		}
+	}
+	return nil
+}
+
+// setLineErrors adds the errors of a record to the import errors
+func setLineErrors(errs *APIError, line int, apiErr *APIError) {
+	errs.Nest(strconv.Itoa(line), apiErr)
+}
+
+// readImport parses the records of the request body by its content type
+func readImport(r *Request, errs *APIError) ([]importRecord, *APIError) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var records []importRecord
+	var apiErr *APIError
+	switch mediaType {
+	case "text/csv":
+		records, apiErr = readCSV(r.Body)
+	case "application/x-ndjson", "application/ndjson":
+		records = readNDJSON(r.Body, r.bodyLimit(), errs)
+	default:
+		return nil, MessageError(
+			415,
+			CodeUnsupportedMediaType,
+			map[string]interface{}{"type": mediaType},
+		)
+	}
+	if r.bodyTooLarge() {
+		return nil, MessageError(413, CodeBodyTooLarge, nil)
+	}
+	return records, apiErr
+}
+
+// readCSV parses a CSV file with a header row. Empty cells are omitted, so
+// that the defaults of their columns are used.
+func readCSV(body io.Reader) ([]importRecord, *APIError) {
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, unreadableBody(err)
+	}
+
+	records := make([]importRecord, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, unreadableBody(err)
+		}
+		line, _ := reader.FieldPos(0)
+		values := sql.Values{}
+		for i, name := range header {
+			if record[i] != "" {
+				values[name] = record[i]
+			}
+		}
+		records = append(records, importRecord{line: line, values: values})
+	}
+	return records, nil
+}
+
+// readNDJSON parses one JSON object per line, skipping blank lines. Lines
+// that cannot be decoded are added to the errors.
+func readNDJSON(body io.Reader, limit int64, errs *APIError) []importRecord {
+	// Lines may be as long as the body, which fails once it is too large
+	size := math.MaxInt32
+	if limit > 0 && limit < math.MaxInt32 {
+		size = int(limit) + 1
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), size)
+
+	records := make([]importRecord, 0)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		values, apiErr := JSON{Strict: true}.Decode(strings.NewReader(text))
+		if apiErr != nil {
+			setLineErrors(errs, line, apiErr)
+			continue
+		}
+		records = append(records, importRecord{line: line, values: values})
+	}
+	if err := scanner.Err(); err != nil {
+		errs.AddField(strconv.Itoa(line+1), fieldErrors(err)...)
+	}
+	return records
+}
+
+// importRecords validates all records of the import before writing any
+func (c *ResourceSQL) importRecords(r *Request, elem ImportElem) (Response, *APIError) {
+	var rule *UniqueElem
+	switch r.Get("mode") {
+	case "", "insert":
+	case "upsert":
+		if rule = c.uniqueRule(elem.upsert); rule == nil {
+			return nil, MessageError(
+				400, CodeImportMode, map[string]interface{}{"mode": "upsert"},
+			).SetErrorCode(CodeInvalidRequest)
+		}
+	default:
+		return nil, MessageError(
+			400, CodeImportMode, map[string]interface{}{"mode": r.Get("mode")},
+		).SetErrorCode(CodeInvalidRequest)
+	}
+
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	errs := NewError(400)
+	records, apiErr := readImport(r, errs)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Uniques must also hold between the records of the import
+	seen := make(map[string]int)
+	var result ImportResult
+	for i := range records {
+		record := &records[i]
+		if apiErr = c.prepareImport(r, record, scope, rule); apiErr != nil {
+			setLineErrors(errs, record.line, apiErr)
+			continue
+		}
+		for _, unique := range c.uniques {
+			key, ok := importKey(unique, record.values)
+			if !ok {
+				continue
+			}
+			if line, exists := seen[key]; exists {
+				errs.AddField(
+					FieldPath(record.line, unique.columns[0]),
+					Message(CodeDuplicateLine, map[string]interface{}{"line": line}),
+				)
+				continue
+			}
+			seen[key] = record.line
+		}
+		if record.old != nil {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+	if errs.Exists() {
+		errs.AddMetaError(Message(CodeInvalidImport, nil))
+		return nil, errs
+	}
+
+	if r.Get("dry_run") == "true" {
+		result.DryRun = true
+		return result, nil
+	}
+	if apiErr = c.writeImport(r, records, scope, elem.batchSize); apiErr != nil {
+		return nil, apiErr
+	}
+	return result, nil
+}
+
+// importKey returns the normalized values of the unique rule, if none of
+// them are null
+func importKey(unique UniqueElem, values sql.Values) (string, bool) {
+	parts := make([]string, len(unique.columns))
+	for i, name := range unique.columns {
+		value := values[name]
+		if value == nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprint(unique.normalize(value))
+	}
+	return strings.Join(unique.columns, ",") + "=" + strings.Join(parts, "\x00"), true
+}
+
+// prepareImport validates and cleans a single record, and finds the entry
+// it updates in upserts. Dry runs skip the before hooks.
+func (c *ResourceSQL) prepareImport(r *Request, record *importRecord, scope sql.Values, rule *UniqueElem) *APIError {
+	dryRun := r.Get("dry_run") == "true"
+	values := record.values
+	if len(values) == 0 {
+		return MessageError(400, CodeEmptyRequest, nil)
+	}
+	if apiErr := c.Validate(values); apiErr != nil {
+		return apiErr
+	}
+	for name, value := range scope {
+		values[name] = value
+	}
+	c.normalizeValues(values)
+
+	m := POST
+	if rule != nil {
+		old, apiErr := c.findUnique(r.Tx, *rule, values, scope)
+		if apiErr != nil {
+			return apiErr
+		}
+		if record.old = old; old != nil {
+			m = PATCH
+		}
+	}
+	if apiErr := c.authorize(r, m, values); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := c.checkWritable(r, values); apiErr != nil {
+		return apiErr
+	}
+
+	key := c.table.PrimaryKey()[0]
+	if record.old == nil {
+		if apiErr := c.HasRequired(values); apiErr != nil {
+			return apiErr
+		}
+		if apiErr := c.validateObject(r.Tx, values); apiErr != nil {
+			return apiErr
+		}
+		if !dryRun {
+			if apiErr := runHooks(c.hooks.beforeCreate, r, values); apiErr != nil {
+				return apiErr
+			}
+		}
+		if apiErr := c.checkUniques(r.Tx, values, values, nil, scope); apiErr != nil {
+			return apiErr
+		}
+	} else {
+		// Create-only fields keep their existing values
+		for name := range c.createOnly {
+			delete(values, name)
+		}
+		merged := merge(record.old, values)
+		if apiErr := c.validateObject(r.Tx, merged); apiErr != nil {
+			return apiErr
+		}
+		if !dryRun {
+			if apiErr := runUpdateHooks(c.hooks.beforeUpdate, r, record.old, values); apiErr != nil {
+				return apiErr
+			}
+		}
+		if apiErr := c.checkUniques(r.Tx, merged, values, record.old[key], scope); apiErr != nil {
+			return apiErr
+		}
+	}
+	return c.checkForeignKeys(r, values, scope)
+}
+
+// findUnique returns every column of the entry that matches the values of
+// the unique rule, or nil if there is none
+func (c *ResourceSQL) findUnique(conn sql.Connection, rule UniqueElem, values sql.Values, scope sql.Values) (sql.Values, *APIError) {
+	clauses := make([]sql.Clause, 0, len(rule.columns))
+	for _, name := range rule.columns {
+		if values[name] == nil {
+			apiErr := NewError(400).SetErrorCode(CodeMissingField)
+			apiErr.AddField(name, Message(CodeMissingField, nil))
+			return nil, apiErr
+		}
+		clauses = append(clauses, rule.clause(c.table.C[name], values[name]))
+	}
+	clauses = append(clauses, scopeClauses(c.table, scope)...)
+	if c.softDelete != nil {
+		clauses = append(clauses, c.softDelete.visible())
+	}
+	stmt := sql.Select(
+		ColumnSet(c.table.Columns()...),
+	).Where(sql.AllOf(clauses...))
+
+	old := sql.Values{}
+	dbErr := conn.QueryOne(stmt, old)
+	if dbErr == sql.ErrNoResult {
+		return nil, nil
+	} else if dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not select upsert entry in sql resource (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+	FixValues(old)
+	return old, nil
+}
+
+// writeImport updates the matched entries and inserts the others in
+// batches of rows with the same columns
+func (c *ResourceSQL) writeImport(r *Request, records []importRecord, scope sql.Values, batchSize int) *APIError {
+	key := c.table.PrimaryKey()[0]
+	groups := make(map[string][]sql.Values)
+	order := make([]string, 0)
+	for _, record := range records {
+		if record.old == nil {
+			names := make([]string, 0, len(record.values))
+			for name := range record.values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			signature := strings.Join(names, ",")
+			if _, exists := groups[signature]; !exists {
+				order = append(order, signature)
+			}
+			groups[signature] = append(groups[signature], record.values)
+			continue
+		}
+
+		pk := record.old[key]
+		stmt := c.table.Update().Values(record.values).Where(c.itemClause(pk, scope))
+		if stmtErr := stmt.Error(); stmtErr != nil {
+			return invalidRequest(stmtErr)
+		}
+		if _, err := r.Tx.Execute(stmt); err != nil {
+			if apiErr := constraintError(err); apiErr != nil {
+				return apiErr
+			}
+			panic(fmt.Sprintf(
+				"argo: could not update in sql resource import (%s): %s",
+				stmt,
+				err,
+			))
+		}
+		updated := c.reload(r, []interface{}{pk})
+		if apiErr := runUpdateHooks(c.hooks.afterUpdate, r, record.old, updated[0]); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	for _, signature := range order {
+		rows := groups[signature]
+		columns := make([]sql.ColumnElem, 0)
+		for _, name := range strings.Split(signature, ",") {
+			columns = append(columns, c.table.C[name])
+		}
+		for start := 0; start < len(rows); start += batchSize {
+			end := start + batchSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+			stmt := postgres.Insert(
+				ColumnSet(columns...),
+			).Returning(c.table.C[key]).Values(rows[start:end])
+			if stmtErr := stmt.Error(); stmtErr != nil {
+				return invalidRequest(stmtErr)
+			}
+
+			inserted := make([]sql.Values, 0)
+			if dbErr := r.Tx.QueryAll(stmt, &inserted); dbErr != nil {
+				if apiErr := constraintError(dbErr); apiErr != nil {
+					return apiErr
+				}
+				panic(fmt.Sprintf(
+					"argo: could not insert in sql resource import (%s): %s",
+					stmt,
+					dbErr,
+				))
+			}
+			pks := make([]interface{}, len(inserted))
+			for i, row := range inserted {
+				pks[i] = row[key]
+			}
+			created := c.reload(r, pks)
+			if apiErr := runHooks(c.hooks.afterCreate, r, created...); apiErr != nil {
+				return apiErr
+			}
+		}
+	}
+	return nil
+}
+
+// reload selects the entries with the given primary keys as the request
+// would read them
+func (c *ResourceSQL) reload(r *Request, pks []interface{}) []sql.Values {
+	key := c.table.PrimaryKey()[0]
+	stmt := sql.Select(c.readable(r)).Where(c.table.C[key].In(pks))
+	results := make([]sql.Values, 0)
+	if dbErr := r.Tx.QueryAll(stmt, &results); dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not reload entries in sql resource (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+	FixValues(results...)
+	return results
+}
@@ -0,0 +1,165 @@
+package argo
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadImport(t *testing.T) {
+	assert := assert.New(t)
+
+	records, errAPI := readCSV(strings.NewReader(
+		"name,age\nadmin,20\n\"multi\nline\",\nclient,30\n",
+	))
+	require.Nil(t, errAPI)
+	require.Equal(t, 3, len(records))
+	assert.Equal(2, records[0].line)
+	assert.Equal(sql.Values{"name": "admin", "age": "20"}, records[0].values)
+	assert.Equal(sql.Values{"name": "multi\nline"}, records[1].values)
+	assert.Equal(5, records[2].line)
+
+	_, errAPI = readCSV(strings.NewReader("name,age\nadmin\n"))
+	assert.NotNil(errAPI)
+
+	errs := NewError(400)
+	records = readNDJSON(strings.NewReader(
+		"{\"name\":\"admin\"}\n\n[1]\n{\"name\":\"client\",\"age\":3}\n",
+	), 0, errs)
+	require.Equal(t, 2, len(records))
+	assert.Equal(1, records[0].line)
+	assert.Equal(4, records[1].line)
+	assert.Equal(int64(3), records[1].values["age"])
+	assert.Equal(true, errs.Exists())
+	_, exists := errs.Fields["3"]
+	assert.Equal(true, exists)
+
+	// Lines may be as long as the body limit of the request
+	line := `{"name":"` + strings.Repeat("a", int(DefaultMaxBodySize)) + `"}` + "\n"
+	r := MockRequest([]byte(line), nil)
+	r.Header = http.Header{}
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Body = newLimitedBody(r.Body, 2*DefaultMaxBodySize)
+	records, errAPI = readImport(r, NewError(400))
+	require.Nil(t, errAPI)
+	assert.Equal(1, len(records))
+
+	r = MockRequest([]byte(line), nil)
+	r.Header = http.Header{}
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Body = newLimitedBody(r.Body, DefaultMaxBodySize/2)
+	_, errAPI = readImport(r, NewError(400))
+	require.NotNil(t, errAPI)
+	assert.Equal(413, errAPI.code)
+
+	// Other formats are unsupported
+	r = MockRequest([]byte(`{}`), nil)
+	r.Header = http.Header{}
+	r.Header.Set("Content-Type", "application/json")
+	_, errAPI = readImport(r, NewError(400))
+	require.NotNil(t, errAPI)
+	assert.Equal(415, errAPI.code)
+}
+
+func TestResource_ImportDryRunHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int
+	documents := Resource(
+		FromTable(documentsDB),
+		BeforeCreate(func(r *Request, values sql.Values) *APIError {
+			calls++
+			return nil
+		}),
+	)
+	record := func() *importRecord {
+		return &importRecord{
+			line:   2,
+			values: sql.Values{"org_id": int64(1), "name": "a"},
+		}
+	}
+
+	dryRun := MockRequest(nil, url.Values{"dry_run": []string{"true"}})
+	require.Nil(t, documents.prepareImport(dryRun, record(), nil, nil))
+	assert.Equal(0, calls)
+
+	require.Nil(t, documents.prepareImport(MockRequest(nil, nil), record(), nil, nil))
+	assert.Equal(1, calls)
+}
+
+func TestResource_Import(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(
+		FromTable(usersDB),
+		Import().Upsert("name").BatchSize(2),
+	)
+	users.conn = tx
+
+	handler := users.Actions()[0].Handler
+	request := func(body string, values url.Values) *Request {
+		r := MockRequest([]byte(body), values)
+		r.Header = http.Header{}
+		r.Header.Set("Content-Type", "text/csv")
+		return r
+	}
+
+	// Every invalid record is reported and nothing is written
+	_, errAPI := handler(request(
+		"name,age,password\na,1,x\nb,,x\na,2,x\n", nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+	assert.Equal(2, len(errAPI.Fields))
+
+	response, errAPI := users.List(MockRequest(nil, nil))
+	require.Nil(t, errAPI)
+	assert.Equal(0, len(response.(MultiResponse).Results.([]sql.Values)))
+
+	// Dry runs only validate
+	body := "name,age,password\na,1,x\nb,2,x\nc,3,x\n"
+	dryRun := url.Values{"dry_run": []string{"true"}}
+	response, errAPI = handler(request(body, dryRun))
+	require.Nil(t, errAPI)
+	assert.Equal(ImportResult{Created: 3, DryRun: true}, response)
+
+	response, errAPI = handler(request(body, nil))
+	require.Nil(t, errAPI)
+	assert.Equal(ImportResult{Created: 3}, response)
+
+	response, errAPI = users.List(MockRequest(nil, nil))
+	require.Nil(t, errAPI)
+	assert.Equal(3, len(response.(MultiResponse).Results.([]sql.Values)))
+
+	// Inserting existing names fails, upserting updates them
+	body = "name,age,password\na,10,x\nd,4,x\n"
+	_, errAPI = handler(request(body, nil))
+	require.NotNil(t, errAPI)
+
+	upsert := url.Values{"mode": []string{"upsert"}}
+	response, errAPI = handler(request(body, upsert))
+	require.Nil(t, errAPI)
+	assert.Equal(ImportResult{Created: 1, Updated: 1}, response)
+
+	response, errAPI = users.List(MockRequest(nil, url.Values{"name": []string{"a"}}))
+	require.Nil(t, errAPI)
+	results := response.(MultiResponse).Results.([]sql.Values)
+	require.Equal(t, 1, len(results))
+	assert.Equal(int64(10), results[0]["age"])
+
+	// NDJSON
+	r := MockRequest([]byte(`{"name":"e","age":5,"password":"x"}`+"\n"), nil)
+	r.Header = http.Header{}
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	response, errAPI = handler(r)
+	require.Nil(t, errAPI)
+	assert.Equal(ImportResult{Created: 1}, response)
+}
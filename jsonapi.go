@@ -0,0 +1,359 @@
+package argo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+)
+
+// JSONAPI implements the JSON:API media type. Entries are encoded as
+// resource objects whose type is the name of the resource, and Many and
+// ManyToMany includes as relationships whose entries are added to the
+// compound document. Errors are encoded as an errors array.
+//
+// The API sets the type of each request; the resource objects of Post and
+// Patch payloads must have the same type, and their attributes are decoded
+// as the values of the entry. Entries are identified by the URL: the id of
+// an item payload must match it, and new entries cannot have client ids.
+// Relationships cannot be written. Strict decoding rejects duplicate keys,
+// data after the document and members that JSON:API does not define.
+type JSONAPI struct {
+	Type     string
+	Strict   bool
+	resource *ResourceSQL
+	routed   bool   // The URL of the request is known, see forParams
+	id       string // The id of the requested item, empty for collections
+}
+
+// forResource sets the type and resource of the request
+func (c JSONAPI) forResource(name string, resource Rest) JSONAPI {
+	c.Type = name
+	c.resource, _ = resource.(*ResourceSQL)
+	return c
+}
+
+// forParams sets the id of the requested item from the URL parameters
+func (c JSONAPI) forParams(params Params) JSONAPI {
+	c.routed = true
+	if len(params) > 0 {
+		c.id = params[0].Value
+	}
+	return c
+}
+
+// jsonapiObject is a JSON:API resource object
+type jsonapiObject struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    sql.Values                     `json:"attributes"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+}
+
+// jsonapiRelationship is a to-many relationship of a resource object
+type jsonapiRelationship struct {
+	Data []jsonapiIdentifier `json:"data"`
+}
+
+// jsonapiIdentifier identifies a resource object
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// jsonapiError is an error object of a JSON:API errors array
+type jsonapiError struct {
+	Status string         `json:"status"`
+	Code   string         `json:"code"`
+	Detail string         `json:"detail"`
+	Source *jsonapiSource `json:"source,omitempty"`
+}
+
+type jsonapiSource struct {
+	Pointer string `json:"pointer"`
+}
+
+// jsonapiRelation describes how an include is mapped to a relationship
+type jsonapiRelation struct {
+	name string
+	typ  string
+	key  string
+}
+
+// relations returns the includes of the resource that can be mapped to
+// relationships, which are those whose entries have a primary key. Lists
+// have the list includes of the resource, and entries its detail includes.
+func (c JSONAPI) relations(list bool) []jsonapiRelation {
+	if c.resource == nil {
+		return nil
+	}
+	includes := c.resource.detailIncludes
+	if list {
+		includes = c.resource.listIncludes
+	}
+	relations := make([]jsonapiRelation, 0)
+	for _, include := range includes {
+		var relation jsonapiRelation
+		var table *sql.TableElem
+		switch elem := include.(type) {
+		case ManyElem:
+			if elem.asMap != nil {
+				continue
+			}
+			relation.name, table = elem.name, elem.table
+		case ManyToManyElem:
+			relation.name, table = elem.name, elem.table
+		default:
+			continue
+		}
+		pk := table.PrimaryKey()
+		if len(pk) != 1 {
+			continue
+		}
+		relation.typ, relation.key = table.Name, pk[0]
+		relations = append(relations, relation)
+	}
+	return relations
+}
+
+// key returns the primary key of the resource
+func (c JSONAPI) key() string {
+	if c.resource == nil {
+		return "id"
+	}
+	return c.resource.table.PrimaryKey()[0]
+}
+
+// formatID converts the value of a primary key to a JSON:API id
+func formatID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonapiDocument collects the included entries of a compound document
+type jsonapiDocument struct {
+	relations []jsonapiRelation
+	key       string
+	typ       string
+	included  []jsonapiObject
+	seen      map[jsonapiIdentifier]bool
+}
+
+func (doc *jsonapiDocument) object(values sql.Values) jsonapiObject {
+	object := jsonapiObject{
+		Type:       doc.typ,
+		ID:         formatID(values[doc.key]),
+		Attributes: sql.Values{},
+	}
+	for name, value := range values {
+		if name != doc.key {
+			object.Attributes[name] = value
+		}
+	}
+
+	for _, relation := range doc.relations {
+		entries, ok := values[relation.name].([]sql.Values)
+		if !ok {
+			continue
+		}
+		delete(object.Attributes, relation.name)
+		data := make([]jsonapiIdentifier, 0, len(entries))
+		for _, entry := range entries {
+			identifier := jsonapiIdentifier{
+				Type: relation.typ,
+				ID:   formatID(entry[relation.key]),
+			}
+			data = append(data, identifier)
+			if doc.seen[identifier] {
+				continue
+			}
+			doc.seen[identifier] = true
+			attributes := sql.Values{}
+			for name, value := range entry {
+				if name != relation.key {
+					attributes[name] = value
+				}
+			}
+			doc.included = append(doc.included, jsonapiObject{
+				Type:       relation.typ,
+				ID:         identifier.ID,
+				Attributes: attributes,
+			})
+		}
+		if object.Relationships == nil {
+			object.Relationships = make(map[string]jsonapiRelationship)
+		}
+		object.Relationships[relation.name] = jsonapiRelationship{Data: data}
+	}
+	return object
+}
+
+func (c JSONAPI) Encode(i interface{}) []byte {
+	doc := &jsonapiDocument{
+		key:      c.key(),
+		typ:      c.Type,
+		included: make([]jsonapiObject, 0),
+		seen:     make(map[jsonapiIdentifier]bool),
+	}
+
+	output := make(map[string]interface{})
+	switch response := i.(type) {
+	case MultiResponse:
+		results, ok := response.Results.([]sql.Values)
+		if !ok {
+			output["meta"] = response
+			break
+		}
+		doc.relations = c.relations(true)
+		data := make([]jsonapiObject, len(results))
+		for j, result := range results {
+			data[j] = doc.object(result)
+		}
+		output["data"] = data
+		output["meta"] = response.Meta
+	case sql.Values:
+		doc.relations = c.relations(false)
+		output["data"] = doc.object(response)
+	case *APIError:
+		output["errors"] = c.errors(response)
+	case APIError:
+		output["errors"] = c.errors(&response)
+	default:
+		// Responses that are not entries are sent as meta
+		output["meta"] = i
+	}
+	if len(doc.included) > 0 {
+		output["included"] = doc.included
+	}
+
+	b, err := json.Marshal(output)
+	if err != nil {
+		panic(fmt.Sprintf(
+			"argo: could not JSON:API encode response: %s",
+			err,
+		))
+	}
+	return b
+}
+
+// errors converts the error into error objects. Field errors point to the
+// attributes of the payload.
+func (c JSONAPI) errors(e *APIError) []jsonapiError {
+	status := strconv.Itoa(e.code)
+	errors := make([]jsonapiError, 0, len(e.Meta)+len(e.Fields))
+	for _, meta := range e.Meta {
+		errors = append(errors, jsonapiError{
+			Status: status,
+			Code:   e.ErrorCode(),
+			Detail: meta,
+		})
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pointer := "/data/attributes/" + strings.Replace(name, ".", "/", -1)
+		for _, err := range e.errorsOf(name) {
+			errors = append(errors, jsonapiError{
+				Status: status,
+				Code:   err.Code,
+				Detail: err.Message,
+				Source: &jsonapiSource{Pointer: pointer},
+			})
+		}
+	}
+	return errors
+}
+
+// Decode implements the Decoder interface for payloads with a single
+// resource object
+func (c JSONAPI) Decode(data io.Reader) (sql.Values, *APIError) {
+	// Members that are defined by JSON:API but not used are still decoded,
+	// so that strict decoding only rejects unknown members
+	var payload struct {
+		Data *struct {
+			Type          string                     `json:"type"`
+			ID            interface{}                `json:"id"`
+			Attributes    json.RawMessage            `json:"attributes"`
+			Relationships map[string]json.RawMessage `json:"relationships"`
+			Links         json.RawMessage            `json:"links"`
+			Meta          json.RawMessage            `json:"meta"`
+		} `json:"data"`
+		Included json.RawMessage `json:"included"`
+		JSONAPI  json.RawMessage `json:"jsonapi"`
+		Links    json.RawMessage `json:"links"`
+		Meta     json.RawMessage `json:"meta"`
+	}
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return sql.Values{}, invalidRequest(err)
+	}
+	if c.Strict {
+		if err = checkStrictJSON(b); err != nil {
+			return sql.Values{}, invalidRequest(err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if c.Strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err = decoder.Decode(&payload); err != nil {
+		return sql.Values{}, invalidRequest(err)
+	}
+	if payload.Data == nil {
+		return sql.Values{}, MessageError(
+			400, CodeMissingData, nil,
+		).SetErrorCode(CodeInvalidRequest)
+	}
+	if c.Type != "" && payload.Data.Type != c.Type {
+		return sql.Values{}, MessageError(
+			409,
+			CodeWrongType,
+			map[string]interface{}{"expected": c.Type, "type": payload.Data.Type},
+		).SetErrorCode(CodeConflict)
+	}
+	if id := payload.Data.ID; c.routed && id != nil && id != "" {
+		if c.id == "" {
+			return sql.Values{}, MessageError(
+				403, CodeClientID, nil,
+			).SetErrorCode(CodeForbidden)
+		}
+		if formatID(id) != c.id {
+			return sql.Values{}, MessageError(
+				409,
+				CodeWrongID,
+				map[string]interface{}{"expected": c.id, "id": formatID(id)},
+			).SetErrorCode(CodeConflict)
+		}
+	}
+	if len(payload.Data.Relationships) > 0 {
+		return sql.Values{}, MessageError(
+			400, CodeRelationships, nil,
+		).SetErrorCode(CodeInvalidRequest)
+	}
+
+	if len(payload.Data.Attributes) == 0 {
+		return sql.Values{}, nil
+	}
+	// Attributes are decoded as JSON, so that numbers are decoded the same
+	return JSON{Strict: c.Strict}.Decode(bytes.NewReader(payload.Data.Attributes))
+}
+
+func (c JSONAPI) MediaType() string {
+	return "application/vnd.api+json"
+}
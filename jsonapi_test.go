@@ -0,0 +1,136 @@
+package argo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONAPI_Encode(t *testing.T) {
+	assert := assert.New(t)
+
+	companies := Resource(FromTable(companyDB), Many("contacts", contactsDB))
+	codec := JSONAPI{}.forResource("companies", companies)
+
+	contact := sql.Values{"id": int64(3), "key": "email", "value": "a@b.c"}
+	response := MultiResponse{
+		Meta: Meta{Limit: 10},
+		Results: []sql.Values{
+			{"id": int64(1), "name": "a", "contacts": []sql.Values{contact}},
+			{"id": int64(2), "name": "b", "contacts": []sql.Values{contact}},
+		},
+	}
+
+	var document struct {
+		Data     []jsonapiObject `json:"data"`
+		Included []jsonapiObject `json:"included"`
+		Meta     Meta            `json:"meta"`
+	}
+	require.Nil(t, json.Unmarshal(codec.Encode(response), &document))
+	require.Equal(t, 2, len(document.Data))
+	assert.Equal("companies", document.Data[0].Type)
+	assert.Equal("1", document.Data[0].ID)
+	assert.Equal(sql.Values{"name": "a"}, document.Data[0].Attributes)
+	assert.Equal(
+		[]jsonapiIdentifier{{Type: "contacts", ID: "3"}},
+		document.Data[1].Relationships["contacts"].Data,
+	)
+	assert.Equal(10, document.Meta.Limit)
+
+	// Entries included by several results are included once
+	require.Equal(t, 1, len(document.Included))
+	assert.Equal("email", document.Included[0].Attributes["key"])
+
+	// Lists only have the relationships of their includes
+	detailOnly := Resource(
+		FromTable(companyDB), Many("contacts", contactsDB).DetailOnly(),
+	)
+	codec = JSONAPI{}.forResource("companies", detailOnly)
+	var list struct {
+		Data []jsonapiObject `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal(codec.Encode(response), &list))
+	assert.Equal(0, len(list.Data[0].Relationships))
+	var entry struct {
+		Data jsonapiObject `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal(codec.Encode(response.Results.([]sql.Values)[0]), &entry))
+	assert.Contains(entry.Data.Relationships, "contacts")
+
+	apiErr := MetaError(400, "bad")
+	apiErr.SetField("name", "is required")
+	assert.Equal(
+		`{"errors":[{"status":"400","code":"invalid_request","detail":"bad"},`+
+			`{"status":"400","code":"invalid_field","detail":"is required","source":{"pointer":"/data/attributes/name"}}]}`,
+		string(codec.Encode(apiErr)),
+	)
+}
+
+func TestJSONAPI_Decode(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := JSONAPI{Type: "users"}
+	values, apiErr := codec.Decode(strings.NewReader(
+		`{"data":{"type":"users","id":"1","attributes":{"name":"a","age":2}}}`,
+	))
+	require.Nil(t, apiErr)
+	assert.Equal(sql.Values{"name": "a", "age": int64(2)}, values)
+
+	_, apiErr = codec.Decode(strings.NewReader(`{"data":{"type":"posts"}}`))
+	require.NotNil(t, apiErr)
+	assert.Equal(409, apiErr.code)
+
+	_, apiErr = codec.Decode(strings.NewReader(`{"name":"a"}`))
+	assert.NotNil(apiErr)
+
+	_, apiErr = codec.Decode(strings.NewReader(
+		`{"data":{"type":"users","relationships":{"posts":{"data":[]}}}}`,
+	))
+	assert.NotNil(apiErr)
+
+	// Item payloads must have the id of the URL
+	item := codec.forParams(Params{{Key: "id", Value: "1"}})
+	_, apiErr = item.Decode(strings.NewReader(`{"data":{"type":"users","id":"1"}}`))
+	assert.Nil(apiErr)
+	_, apiErr = item.Decode(strings.NewReader(`{"data":{"type":"users"}}`))
+	assert.Nil(apiErr)
+	_, apiErr = item.Decode(strings.NewReader(`{"data":{"type":"users","id":"2"}}`))
+	require.NotNil(t, apiErr)
+	assert.Equal(409, apiErr.code)
+
+	// New entries cannot have client-generated ids
+	collection := codec.forParams(nil)
+	_, apiErr = collection.Decode(strings.NewReader(`{"data":{"type":"users","id":"1"}}`))
+	require.NotNil(t, apiErr)
+	assert.Equal(403, apiErr.code)
+	_, apiErr = collection.Decode(strings.NewReader(`{"data":{"type":"users"}}`))
+	assert.Nil(apiErr)
+
+	// Strict decoding rejects duplicate keys and unknown members
+	strict := JSONAPI{Type: "users", Strict: true}
+	_, apiErr = strict.Decode(strings.NewReader(
+		`{"data":{"type":"users","attributes":{"name":"a"}},"meta":{}}`,
+	))
+	assert.Nil(apiErr)
+	for _, body := range []string{
+		`{"data":{"type":"users","attributes":{"name":"a","name":"b"}}}`,
+		`{"data":{"type":"users"},"data":{"type":"users"}}`,
+		`{"data":{"type":"users","attributes":{}},"extra":1}`,
+		`{"data":{"type":"users","attributes":{},"extra":1}}`,
+		`{"data":{"type":"users"}} {}`,
+	} {
+		_, apiErr = strict.Decode(strings.NewReader(body))
+		assert.NotNil(apiErr, body)
+	}
+
+	// Without it, the last duplicate wins
+	values, apiErr = codec.Decode(strings.NewReader(
+		`{"data":{"type":"users","attributes":{"name":"a","name":"b"}}}`,
+	))
+	require.Nil(t, apiErr)
+	assert.Equal(sql.Values{"name": "b"}, values)
+}
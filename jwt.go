@@ -0,0 +1,328 @@
+package argo
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWTKey verifies the signatures of JWT bearer tokens. HMAC keys verify
+// the HS256, HS384 and HS512 algorithms and RSA keys verify RS256, RS384
+// and RS512; a key never verifies an algorithm of the other kind.
+type JWTKey struct {
+	ID     string // Matched against the kid header of tokens, if both are set
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// HMACKey creates a key for tokens signed with the given shared secret
+func HMACKey(id string, secret []byte) JWTKey {
+	return JWTKey{ID: id, secret: secret}
+}
+
+// RSAKey creates a key for tokens signed with the private key of the
+// given public key
+func RSAKey(id string, public *rsa.PublicKey) JWTKey {
+	return JWTKey{ID: id, public: public}
+}
+
+// ParseJWKS parses the keys of a JSON Web Key Set. RSA and symmetric
+// ("oct") signing keys are supported; other keys are skipped.
+func ParseJWKS(data []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("argo: could not parse JWKS: %s", err)
+	}
+
+	keys := make([]JWTKey, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"argo: invalid modulus of JWKS key '%s': %s", jwk.Kid, err,
+				)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil || len(e) == 0 {
+				return nil, fmt.Errorf(
+					"argo: invalid exponent of JWKS key '%s'", jwk.Kid,
+				)
+			}
+			public := &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+			keys = append(keys, RSAKey(jwk.Kid, public))
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"argo: invalid secret of JWKS key '%s': %s", jwk.Kid, err,
+				)
+			}
+			keys = append(keys, HMACKey(jwk.Kid, secret))
+		}
+	}
+	return keys, nil
+}
+
+// LoadJWKS reads the keys of the JSON Web Key Set file at the given path
+func LoadJWKS(path string) ([]JWTKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("argo: could not read JWKS file: %s", err)
+	}
+	return ParseJWKS(data)
+}
+
+// Algorithms supported for JWT signatures
+var jwtAlgorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// Message codes of invalid bearer tokens
+const (
+	CodeInvalidToken   = "invalid_token"
+	CodeTokenSignature = "token_signature"
+	CodeTokenExpired   = "token_expired"
+	CodeTokenNotBefore = "token_not_before"
+	CodeTokenIssuer    = "token_issuer"
+	CodeTokenAudience  = "token_audience"
+	CodeTokenAlgorithm = "token_algorithm"
+)
+
+var (
+	errInvalidToken   = Message(CodeInvalidToken, nil)
+	errTokenSignature = Message(CodeTokenSignature, nil)
+	errTokenExpired   = Message(CodeTokenExpired, nil)
+	errTokenNotBefore = Message(CodeTokenNotBefore, nil)
+	errTokenIssuer    = Message(CodeTokenIssuer, nil)
+	errTokenAudience  = Message(CodeTokenAudience, nil)
+)
+
+// JWTAuthenticator authenticates requests with signed JWT bearer tokens
+// in the Authorization header. The sub claim of the token is the ID of
+// the principal, and its roles are read from the roles claim.
+type JWTAuthenticator struct {
+	keys       []JWTKey
+	issuer     string
+	audience   string
+	rolesClaim string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// Issuer requires tokens to have the given iss claim
+func (auth *JWTAuthenticator) Issuer(issuer string) *JWTAuthenticator {
+	auth.issuer = issuer
+	return auth
+}
+
+// Audience requires tokens to have the given aud claim
+func (auth *JWTAuthenticator) Audience(audience string) *JWTAuthenticator {
+	auth.audience = audience
+	return auth
+}
+
+// RolesClaim sets the claim that holds the roles of the principal, either
+// as a list of strings or a space-separated string. It defaults to roles.
+func (auth *JWTAuthenticator) RolesClaim(name string) *JWTAuthenticator {
+	auth.rolesClaim = name
+	return auth
+}
+
+// Leeway allows for clock skew when checking the exp and nbf claims
+func (auth *JWTAuthenticator) Leeway(leeway time.Duration) *JWTAuthenticator {
+	auth.leeway = leeway
+	return auth
+}
+
+// Challenge implements the Authenticator interface
+func (auth *JWTAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// Authenticate implements the Authenticator interface
+func (auth *JWTAuthenticator) Authenticate(r *Request) (*Principal, error) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil, nil
+	}
+	claims, err := auth.verify(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Claims: claims}
+	if sub, ok := claims["sub"].(string); ok {
+		principal.ID = sub
+	}
+	switch roles := claims[auth.rolesClaim].(type) {
+	case string:
+		principal.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, role := range roles {
+			if str, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, str)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// verify checks the signature and the registered claims of the token and
+// returns its claims
+func (auth *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	hash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, Message(
+			CodeTokenAlgorithm, map[string]interface{}{"algorithm": header.Alg},
+		)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	var verified bool
+	for _, key := range auth.keys {
+		if header.Kid != "" && key.ID != "" && header.Kid != key.ID {
+			continue
+		}
+		if verified = key.verify(header.Alg, hash, signed, signature); verified {
+			break
+		}
+	}
+	if !verified {
+		return nil, errTokenSignature
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil || claims == nil {
+		return nil, errInvalidToken
+	}
+	now := auth.now()
+	if exp, exists := claims["exp"]; exists {
+		seconds, ok := exp.(float64)
+		if !ok {
+			return nil, errInvalidToken
+		}
+		if now.After(time.Unix(int64(seconds), 0).Add(auth.leeway)) {
+			return nil, errTokenExpired
+		}
+	}
+	if nbf, exists := claims["nbf"]; exists {
+		seconds, ok := nbf.(float64)
+		if !ok {
+			return nil, errInvalidToken
+		}
+		if now.Add(auth.leeway).Before(time.Unix(int64(seconds), 0)) {
+			return nil, errTokenNotBefore
+		}
+	}
+	if auth.issuer != "" && claims["iss"] != auth.issuer {
+		return nil, errTokenIssuer
+	}
+	if auth.audience != "" && !hasAudience(claims["aud"], auth.audience) {
+		return nil, errTokenAudience
+	}
+	return claims, nil
+}
+
+// verify checks the signature with the key, if the key is of the kind
+// used by the algorithm
+func (key JWTKey) verify(alg string, hash crypto.Hash, signed, signature []byte) bool {
+	switch alg[:2] {
+	case "HS":
+		if key.secret == nil {
+			return false
+		}
+		mac := hmac.New(hash.New, key.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case "RS":
+		if key.public == nil {
+			return false
+		}
+		h := hash.New()
+		h.Write(signed)
+		return rsa.VerifyPKCS1v15(key.public, hash, h.Sum(nil), signature) == nil
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// hasAudience returns true if the aud claim, which is either a string or a
+// list of strings, includes the given audience
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JWT creates an authenticator for bearer tokens signed by any of the
+// given keys
+func JWT(keys ...JWTKey) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		keys:       keys,
+		rolesClaim: "roles",
+		now:        time.Now,
+	}
+}
@@ -0,0 +1,144 @@
+package argo
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeSegment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(secret []byte, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": "HS256", "typ": "JWT"}) +
+		"." + encodeSegment(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": "RS256", "kid": kid}) +
+		"." + encodeSegment(claims)
+	hash := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func bearerRequest(token string) *Request {
+	r := MockRequest(nil, nil)
+	r.Header = http.Header{"Authorization": []string{"Bearer " + token}}
+	return r
+}
+
+func TestJWT(t *testing.T) {
+	assert := assert.New(t)
+	secret := []byte("secret")
+	now := time.Unix(1500000000, 0)
+
+	auth := JWT(HMACKey("", secret)).Issuer("argo").Audience("api")
+	auth.now = func() time.Time { return now }
+
+	claims := map[string]interface{}{
+		"sub":   "1",
+		"iss":   "argo",
+		"aud":   []string{"api", "web"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"roles": []string{"admin"},
+	}
+	principal, err := auth.Authenticate(bearerRequest(signHS256(secret, claims)))
+	require.Nil(t, err)
+	require.NotNil(t, principal)
+	assert.Equal("1", principal.ID)
+	assert.True(principal.HasRole("admin"))
+	assert.False(principal.HasRole("hr"))
+
+	// Requests without a bearer token are anonymous
+	principal, err = auth.Authenticate(MockRequest(nil, nil))
+	assert.Nil(err)
+	assert.Nil(principal)
+
+	// Invalid tokens are errors
+	_, err = auth.Authenticate(bearerRequest("abc"))
+	assert.Equal(errInvalidToken, err)
+
+	_, err = auth.Authenticate(bearerRequest(signHS256([]byte("other"), claims)))
+	assert.Equal(errTokenSignature, err)
+
+	claims["exp"] = now.Add(-time.Minute).Unix()
+	_, err = auth.Authenticate(bearerRequest(signHS256(secret, claims)))
+	assert.Equal(errTokenExpired, err)
+
+	// Unless they are within the leeway
+	auth.Leeway(2 * time.Minute)
+	_, err = auth.Authenticate(bearerRequest(signHS256(secret, claims)))
+	assert.Nil(err)
+
+	claims["iss"] = "other"
+	_, err = auth.Authenticate(bearerRequest(signHS256(secret, claims)))
+	assert.Equal(errTokenIssuer, err)
+
+	claims["iss"] = "argo"
+	claims["aud"] = "web"
+	_, err = auth.Authenticate(bearerRequest(signHS256(secret, claims)))
+	assert.Equal(errTokenAudience, err)
+
+	// Unsigned tokens are never accepted
+	unsigned := encodeSegment(map[string]string{"alg": "none"}) +
+		"." + encodeSegment(claims) + "."
+	_, err = auth.Authenticate(bearerRequest(unsigned))
+	assert.NotNil(err)
+
+	// Unsupported algorithms have a code of their own
+	msg, ok := err.(FieldError)
+	require.True(t, ok)
+	assert.Equal(CodeTokenAlgorithm, msg.Code)
+	assert.Equal("unsupported bearer token algorithm: none", msg.Message)
+}
+
+func TestJWT_RSA(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.Nil(t, err)
+
+	jwks := fmt.Sprintf(
+		`{"keys":[{"kty":"RSA","kid":"a","use":"sig","n":"%s","e":"%s"},{"kty":"EC","kid":"b"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	)
+	keys, err := ParseJWKS([]byte(jwks))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(keys))
+	assert.Equal("a", keys[0].ID)
+
+	auth := JWT(keys...)
+	claims := map[string]interface{}{"sub": "2", "roles": "hr staff"}
+	principal, err := auth.Authenticate(bearerRequest(signRS256(key, "a", claims)))
+	require.Nil(t, err)
+	assert.Equal("2", principal.ID)
+	assert.Equal([]string{"hr", "staff"}, principal.Roles)
+
+	// Key IDs must match
+	_, err = auth.Authenticate(bearerRequest(signRS256(key, "b", claims)))
+	assert.Equal(errTokenSignature, err)
+
+	// RSA keys cannot verify HMAC signatures
+	public := key.PublicKey.N.Bytes()
+	_, err = auth.Authenticate(bearerRequest(signHS256(public, claims)))
+	assert.Equal(errTokenSignature, err)
+}
@@ -0,0 +1,117 @@
+package argo
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultMaxBodySize is the maximum size in bytes of request bodies of new
+// APIs
+const DefaultMaxBodySize int64 = 1 << 20
+
+var errBodyTooLarge = errors.New("the request body is too large")
+
+// limitedBody fails reads once more than its limit has been read
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+	exceeded  bool
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) *limitedBody {
+	return &limitedBody{ReadCloser: body, limit: limit, remaining: limit}
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.exceeded {
+		return 0, errBodyTooLarge
+	}
+	// Read one more byte than allowed to detect bodies that are too large
+	if int64(len(p)) > body.remaining+1 {
+		p = p[:body.remaining+1]
+	}
+	n, err := body.ReadCloser.Read(p)
+	if int64(n) > body.remaining {
+		body.exceeded = true
+		body.remaining = 0
+		return 0, errBodyTooLarge
+	}
+	body.remaining -= int64(n)
+	return n, err
+}
+
+// BodyLimiter is implemented by resources with their own maximum request
+// body size
+type BodyLimiter interface {
+	MaxBodySize() int64
+}
+
+// MaxBodySize returns a Modifier that sets the maximum size in bytes of
+// request bodies to the resource, overriding the limit of the API
+func MaxBodySize(size int64) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.maxBodySize = size
+		return nil
+	})
+}
+
+// MaxBodySize implements the BodyLimiter interface. Zero uses the limit
+// of the API.
+func (c *ResourceSQL) MaxBodySize() int64 {
+	return c.maxBodySize
+}
+
+// MaxBodySize sets the maximum size in bytes of request bodies. Larger
+// bodies are rejected with 413. Zero or less removes the limit.
+func (api *API) MaxBodySize(size int64) *API {
+	api.maxBodySize = size
+	return api
+}
+
+// StrictDecoding makes the API reject request bodies with duplicate keys,
+// trailing data or a top-level value other than an object
+func (api *API) StrictDecoding() *API {
+	api.strict = true
+	return api
+}
+
+// limitBody limits the body of the request to the limit of the resource,
+// or else that of the API, and sets strict decoding
+func (api *API) limitBody(request *Request, resource Rest) {
+	if api.strict {
+		switch decoding := request.Decoding.(type) {
+		case JSON:
+			request.Decoding = JSON{Strict: true}
+		case YAML:
+			request.Decoding = YAML{Strict: true}
+		case JSONAPI:
+			decoding.Strict = true
+			request.Decoding = decoding
+		}
+	}
+
+	size := api.maxBodySize
+	if limiter, ok := resource.(BodyLimiter); ok && limiter.MaxBodySize() > 0 {
+		size = limiter.MaxBodySize()
+	}
+	if size > 0 && request.Body != nil {
+		request.Body = newLimitedBody(request.Body, size)
+	}
+}
+
+// bodyLimit returns the maximum size of the request body, or zero if it
+// is not limited
+func (r *Request) bodyLimit() int64 {
+	if body, ok := r.Body.(*limitedBody); ok {
+		return body.limit
+	}
+	return 0
+}
+
+// bodyTooLarge returns true if reading the request body failed because
+// it exceeded its limit
+func (r *Request) bodyTooLarge() bool {
+	body, ok := r.Body.(*limitedBody)
+	return ok && body.exceeded
+}
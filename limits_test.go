@@ -0,0 +1,101 @@
+package argo
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type decodingResource struct {
+	mockResource
+	size int64
+}
+
+func (d decodingResource) Post(r *Request) (Response, *APIError) {
+	values, err := r.Decode(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (d decodingResource) MaxBodySize() int64 {
+	return d.size
+}
+
+func TestAPI_MaxBodySize(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New().MaxBodySize(16).StrictDecoding()
+	api.AddRest("small", decodingResource{})
+	api.AddRest("large", decodingResource{size: 1024})
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	post := func(path, body string) int {
+		resp, err := http.Post(
+			ts.URL+path, "application/json", strings.NewReader(body),
+		)
+		require.Nil(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(http.StatusOK, post("/small", `{"a":"bcdefghi"}`))
+	assert.Equal(
+		http.StatusRequestEntityTooLarge,
+		post("/small", `{"a":"bcdefghij"}`),
+	)
+	assert.Equal(http.StatusOK, post("/large", `{"a":"bcdefghij"}`))
+
+	// Decoding is strict
+	assert.Equal(http.StatusBadRequest, post("/large", `{"a":1,"a":2}`))
+
+	// Including JSON:API documents and their attributes
+	postJSONAPI := func(body string) int {
+		resp, err := http.Post(
+			ts.URL+"/large", "application/vnd.api+json", strings.NewReader(body),
+		)
+		require.Nil(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(http.StatusOK, postJSONAPI(`{"data":{"type":"large","attributes":{"a":1}}}`))
+	assert.Equal(
+		http.StatusBadRequest,
+		postJSONAPI(`{"data":{"type":"large","attributes":{"a":1,"a":2}}}`),
+	)
+	assert.Equal(
+		http.StatusBadRequest,
+		postJSONAPI(`{"data":{"type":"large","type":"large"}}`),
+	)
+}
+
+func TestLimitedBody(t *testing.T) {
+	assert := assert.New(t)
+
+	body := &limitedBody{
+		ReadCloser: ClosingBuffer{bytes.NewBufferString("abcdef")},
+		remaining:  6,
+	}
+	b := make([]byte, 4)
+	n, err := body.Read(b)
+	assert.Nil(err)
+	assert.Equal(4, n)
+	n, err = body.Read(b)
+	assert.Nil(err)
+	assert.Equal(2, n)
+	assert.False(body.exceeded)
+
+	body = &limitedBody{
+		ReadCloser: ClosingBuffer{bytes.NewBufferString("abcdef")},
+		remaining:  5,
+	}
+	b = make([]byte, 10)
+	_, err = body.Read(b)
+	assert.Equal(errBodyTooLarge, err)
+	assert.True(body.exceeded)
+}
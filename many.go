@@ -17,6 +17,7 @@ type ManyElem struct {
 	selects    Columns
 	showFK     bool // By default, foreign key fields will be dropped
 	detailOnly bool
+	softDelete *softDelete
 	asMap      *struct {
 		Key   string
 		Value string
@@ -58,6 +59,29 @@ func (elem ManyElem) DetailOnly() ManyElem {
 	return elem
 }
 
+// SoftDelete hides rows of the included table that have been marked as
+// deleted by the given timestamp or boolean column. Deleted rows are shown
+// only when the parent resource includes its own deleted rows.
+func (elem ManyElem) SoftDelete(name string) ManyElem {
+	sd, err := newSoftDelete(elem.table, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	elem.softDelete = sd
+	return elem
+}
+
+// where returns the clause that selects the included rows matching the
+// given clause within the scope of the request, hiding soft deleted rows
+// unless the request includes them
+func (elem ManyElem) where(r *Request, clause sql.Clause) sql.Clause {
+	clauses := append([]sql.Clause{clause}, scopeClauses(elem.table, scopeOf(r, elem.resource))...)
+	if elem.softDelete != nil && !elem.resource.includeDeleted(r) {
+		clauses = append(clauses, elem.softDelete.visible())
+	}
+	return sql.AllOf(clauses...)
+}
+
 // Exclude removes the given fields by name from the included ManyElem.
 func (elem ManyElem) Exclude(names ...string) ManyElem {
 
@@ -133,6 +157,12 @@ func (elem ManyElem) Modify(resource *ResourceSQL) error {
 
 // Query is the database query method used for single result detail methods.
 func (elem ManyElem) Query(conn sql.Connection, values sql.Values) error {
+	return elem.QueryRequest(nil, conn, values)
+}
+
+// QueryRequest implements the RequestIncluder interface. Soft deleted rows
+// are only included if the request includes deleted rows.
+func (elem ManyElem) QueryRequest(r *Request, conn sql.Connection, values sql.Values) error {
 	// TODO panic or errors
 	// TODO Query by a value that doesn't exist in values?
 	fkValue, ok := values[elem.fk.ForeignName()]
@@ -146,7 +176,7 @@ func (elem ManyElem) Query(conn sql.Connection, values sql.Values) error {
 	stmt := sql.Select(
 		elem.selects,
 	).Where(
-		elem.table.C[elem.fk.Name()].Equals(fkValue),
+		elem.where(r, elem.table.C[elem.fk.Name()].Equals(fkValue)),
 	)
 
 	results := make([]sql.Values, 0)
@@ -199,6 +229,11 @@ func valuesToMap(results []sql.Values, k, v string) map[string]interface{} {
 // QueryAll is the database query method used for building a many
 // relationship with many tables.
 func (elem ManyElem) QueryAll(c sql.Connection, values []sql.Values) error {
+	return elem.QueryAllRequest(nil, c, values)
+}
+
+// QueryAllRequest implements the RequestIncluder interface
+func (elem ManyElem) QueryAllRequest(r *Request, c sql.Connection, values []sql.Values) error {
 	// Get all foreign name values
 	fkValues := make([]interface{}, 0)
 
@@ -228,7 +263,7 @@ func (elem ManyElem) QueryAll(c sql.Connection, values []sql.Values) error {
 	stmt := sql.Select(
 		elem.selects,
 	).Where(
-		elem.table.C[elem.fk.Name()].In(fkValues),
+		elem.where(r, elem.table.C[elem.fk.Name()].In(fkValues)),
 	).OrderBy(elem.table.C[elem.table.PrimaryKey()[0]])
 
 	results := make([]sql.Values, 0)
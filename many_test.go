@@ -26,6 +26,42 @@ var contactsDB = sql.Table("contacts",
 	sql.Unique("company_id", "key", "value"),
 )
 
+// staticInclude is an include that does not depend on the request
+type staticInclude struct{}
+
+func (staticInclude) Query(conn sql.Connection, values sql.Values) error {
+	values["static"] = true
+	return nil
+}
+
+func (staticInclude) QueryAll(conn sql.Connection, values []sql.Values) error {
+	for _, value := range values {
+		value["static"] = true
+	}
+	return nil
+}
+
+func TestQueryIncludes(t *testing.T) {
+	assert := assert.New(t)
+
+	// Includes without the request keep working
+	values := sql.Values{}
+	assert.Nil(queryInclude(staticInclude{}, MockRequest(nil, nil), nil, values))
+	assert.Equal(true, values["static"])
+
+	list := []sql.Values{{}, {}}
+	assert.Nil(queryAllIncludes(staticInclude{}, MockRequest(nil, nil), nil, list))
+	assert.Equal(true, list[1]["static"])
+
+	// Built-in includes receive the request
+	var include Include = Many("contacts", contactsDB)
+	_, ok := include.(RequestIncluder)
+	assert.True(ok)
+	include = ManyToMany("companies", companyDB, companyCampusesDB)
+	_, ok = include.(RequestIncluder)
+	assert.True(ok)
+}
+
 func TestMany(t *testing.T) {
 	assert := assert.New(t)
 
@@ -16,6 +16,7 @@ type ManyToManyElem struct {
 	selects    Columns
 	showFK     bool // By default, foreign key fields will be dropped
 	detailOnly bool
+	softDelete *softDelete
 }
 
 func (elem ManyToManyElem) DetailOnly() ManyToManyElem {
@@ -23,6 +24,29 @@ func (elem ManyToManyElem) DetailOnly() ManyToManyElem {
 	return elem
 }
 
+// SoftDelete hides rows of the element table that have been marked as
+// deleted by the given timestamp or boolean column. Deleted rows are shown
+// only when the parent resource includes its own deleted rows.
+func (elem ManyToManyElem) SoftDelete(name string) ManyToManyElem {
+	sd, err := newSoftDelete(elem.table, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	elem.softDelete = sd
+	return elem
+}
+
+// where returns the clause that selects the included rows matching the
+// given clause within the scope of the request, hiding soft deleted rows
+// unless the request includes them
+func (elem ManyToManyElem) where(r *Request, clause sql.Clause) sql.Clause {
+	clauses := append([]sql.Clause{clause}, scopeClauses(elem.table, scopeOf(r, elem.resource))...)
+	if elem.softDelete != nil && !elem.resource.includeDeleted(r) {
+		clauses = append(clauses, elem.softDelete.visible())
+	}
+	return sql.AllOf(clauses...)
+}
+
 // Exclude removes fields on the  element table from the query
 func (elem ManyToManyElem) Exclude(names ...string) ManyToManyElem {
 
@@ -121,6 +145,12 @@ func (elem ManyToManyElem) Modify(resource *ResourceSQL) error {
 
 // Query is the database query method used for single result detail methods.
 func (elem ManyToManyElem) Query(c sql.Connection, values sql.Values) error {
+	return elem.QueryRequest(nil, c, values)
+}
+
+// QueryRequest implements the RequestIncluder interface. Soft deleted rows
+// are only included if the request includes deleted rows.
+func (elem ManyToManyElem) QueryRequest(r *Request, c sql.Connection, values sql.Values) error {
 	// The values must include the referencing name of the element foreign
 	// key. The rest of the relationship is built from there.
 
@@ -143,7 +173,7 @@ func (elem ManyToManyElem) Query(c sql.Connection, values sql.Values) error {
 		elem.through.C[elem.elementFK.Name()],
 		elem.table.C[elem.elementFK.ForeignName()],
 	).Where(
-		elem.through.C[elem.resourceFK.Name()].Equals(fkValue),
+		elem.where(r, elem.through.C[elem.resourceFK.Name()].Equals(fkValue)),
 	)
 
 	results := make([]sql.Values, 0)
@@ -163,6 +193,11 @@ func (elem ManyToManyElem) Query(c sql.Connection, values sql.Values) error {
 
 // QueryAll is the database query method used for multiple result list methods.
 func (elem ManyToManyElem) QueryAll(c sql.Connection, v []sql.Values) error {
+	return elem.QueryAllRequest(nil, c, v)
+}
+
+// QueryAllRequest implements the RequestIncluder interface
+func (elem ManyToManyElem) QueryAllRequest(r *Request, c sql.Connection, v []sql.Values) error {
 	// Get all foreign name values
 	fkValues := make([]interface{}, 0)
 
@@ -199,7 +234,7 @@ func (elem ManyToManyElem) QueryAll(c sql.Connection, v []sql.Values) error {
 		elem.through.C[elem.elementFK.Name()],
 		elem.table.C[elem.elementFK.ForeignName()],
 	).Where(
-		elem.through.C[elem.resourceFK.Name()].In(fkValues),
+		elem.where(r, elem.through.C[elem.resourceFK.Name()].In(fkValues)),
 	).OrderBy(elem.table.C[elem.table.PrimaryKey()[0]])
 
 	results := make([]sql.Values, 0)
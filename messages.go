@@ -0,0 +1,281 @@
+package argo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Bundle is the message catalog of a single locale. Its templates are
+// keyed by error code, and may refer to the parameters of the error by
+// name, such as "must be at least {min} characters".
+type Bundle map[string]string
+
+// Message codes identify messages that share the error code of their
+// request, such as the errors of imports
+const (
+	CodeNotWritable    = "not_writable"
+	CodeCheckViolation = "check_violation"
+	CodeNotDeleted     = "not_deleted"
+	CodeMissingData    = "missing_data"
+	CodeWrongType      = "wrong_type"
+	CodeWrongID        = "wrong_id"
+	CodeClientID       = "client_id"
+	CodeRelationships  = "relationships"
+	CodeTrailingData   = "trailing_data"
+	CodeUnreadableBody = "unreadable_body"
+	CodeInvalidImport  = "invalid_import"
+	CodeImportMode     = "import_mode"
+	CodeDuplicateLine  = "duplicate_line"
+)
+
+// English is the default bundle. Messages are created in English, and
+// are only translated if the locale of the request has a template for
+// their code.
+var English = Bundle{
+	CodeInvalidRequest:       "{reason}",
+	CodeEmptyRequest:         "refusing to create an entry without values",
+	CodeMissingField:         "is required",
+	CodeUnknownField:         "does not exist",
+	CodeReadOnly:             "is read-only",
+	CodeCreateOnly:           "cannot be changed once created",
+	CodeInvalidValue:         "{reason}",
+	CodeDuplicate:            "already exists",
+	CodeDuplicateTogether:    "already exists together with {columns}",
+	CodeInvalidReference:     "does not exist",
+	CodeReferenced:           "is still referenced by other entries",
+	CodeUnsupportedMethod:    "unsupported method: {method}",
+	CodeUnsupportedFormat:    "the {format} format is not supported by this request",
+	CodeUnsupportedMediaType: "unsupported media type: {type}",
+	CodeNotFound:             "no resource with {key} {value}",
+	CodeUnauthorized:         "authentication is required",
+	CodeForbidden:            "you are not allowed to perform this request",
+	CodePreconditionFailed:   "the entry has been modified",
+	CodePreconditionRequired: "this request requires an If-Match header",
+	CodeBodyTooLarge:         "the request body is too large",
+	CodeRateLimited:          "rate limit exceeded, retry in {seconds} seconds",
+	CodeNotWritable:          "you are not allowed to write this field",
+	CodeCheckViolation:       "violates a check constraint",
+	CodeNotDeleted:           "no deleted resource with {key} {value}",
+	CodeMissingData:          "the payload must have a resource object as data",
+	CodeWrongType:            "the resource object must have the type '{expected}', not '{type}'",
+	CodeWrongID:              "the resource object must have the id '{expected}', not '{id}'",
+	CodeClientID:             "new entries cannot have client-generated ids",
+	CodeRelationships:        "relationships cannot be written",
+	CodeTrailingData:         "the request body has data after the YAML document",
+	CodeUnreadableBody:       "could not read the request body: {reason}",
+	CodeInvalidImport:        "the import is invalid, no records were written",
+	CodeInvalidAPIKey:        "invalid API key",
+	CodeInvalidToken:         "invalid bearer token",
+	CodeTokenSignature:       "invalid bearer token signature",
+	CodeTokenExpired:         "bearer token has expired",
+	CodeTokenNotBefore:       "bearer token is not valid yet",
+	CodeTokenIssuer:          "bearer token has an invalid issuer",
+	CodeTokenAudience:        "bearer token has an invalid audience",
+	CodeTokenAlgorithm:       "unsupported bearer token algorithm: {algorithm}",
+	CodeImportMode:           "unsupported import mode: {mode}",
+	CodeDuplicateLine:        "already exists in line {line}",
+	CodeInvalidType:          "must be a {type}",
+	CodePattern:              "must match the pattern {pattern}",
+	CodeTooShort:             "must be at least {min} characters",
+	CodeTooLong:              "must be at most {max} characters",
+	CodeTooSmall:             "must be at least {min}",
+	CodeTooLarge:             "must be at most {max}",
+	CodeInvalidChoice:        "must be one of {choices}",
+	CodeInvalidEmail:         "is not a valid email address",
+	CodeInvalidURL:           "is not a valid URL",
+	CodeNotNull:              "cannot be null",
+	CodeNotInteger:           "must be an integer",
+	CodeNotNumber:            "must be a number",
+	CodeNotBoolean:           "must be true or false",
+	CodeNotTimestamp:         "must be a timestamp",
+	CodeNotDate:              "must be a date",
+}
+
+// render fills the template of the code with the given parameters
+func (bundle Bundle) render(code string, params map[string]interface{}) (string, bool) {
+	template, exists := bundle[code]
+	if !exists {
+		return "", false
+	}
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(template), true
+}
+
+// Message creates a field error with the English message of the code.
+// Only messages created by Message are translated.
+func Message(code string, params map[string]interface{}) FieldError {
+	msg, exists := English.render(code, params)
+	if !exists {
+		msg = code
+	}
+	return FieldError{Code: code, Message: msg, Params: params, templated: true}
+}
+
+// MessageError returns an API error whose meta error is the English
+// message of the code
+func MessageError(status int, code string, params map[string]interface{}) *APIError {
+	e := NewError(status).SetErrorCode(code)
+	e.AddMetaError(Message(code, params))
+	return e
+}
+
+// invalidRequest returns the error of a request that could not be
+// decoded or built into a statement
+func invalidRequest(err error) *APIError {
+	return MessageError(
+		400, CodeInvalidRequest, map[string]interface{}{"reason": err.Error()},
+	)
+}
+
+// unreadableBody returns the error of a request body that could not be
+// read
+func unreadableBody(err error) *APIError {
+	return MessageError(
+		400, CodeUnreadableBody, map[string]interface{}{"reason": err.Error()},
+	).SetErrorCode(CodeInvalidRequest)
+}
+
+// translate returns the message of the error in the bundle. Messages that
+// were not created by Message, such as custom messages that share a
+// generic code, are never translated.
+func translate(bundle Bundle, err FieldError) string {
+	if !err.templated {
+		return err.Message
+	}
+	if msg, exists := bundle.render(err.Code, err.Params); exists {
+		return msg
+	}
+	return err.Message
+}
+
+// localize translates the messages of the error into the bundle
+func (e *APIError) localize(bundle Bundle) {
+	for i, meta := range e.Meta {
+		if i >= len(e.metaErrors) || e.metaErrors[i].Message != meta {
+			continue
+		}
+		e.Meta[i] = translate(bundle, e.metaErrors[i])
+	}
+	if e.FieldErrors == nil {
+		e.FieldErrors = make(map[string][]FieldError)
+	}
+	for field := range e.Fields {
+		errs := e.errorsOf(field)
+		translated := make([]FieldError, len(errs))
+		for i, err := range errs {
+			err.Message = translate(bundle, err)
+			translated[i] = err
+		}
+		e.FieldErrors[field] = translated
+		e.Fields[field] = FieldErrors(translated).Error()
+	}
+}
+
+// LocaleFunc returns the locale of a request, or an empty string to use
+// its Accept-Language header
+type LocaleFunc func(*Request) string
+
+// Translate registers the bundle of a locale, such as "de" or "pt-BR".
+// Bundles of the same locale are merged. Templates that are missing from
+// a bundle fall back to those of its language and then to English.
+func (api *API) Translate(locale string, bundle Bundle) *API {
+	locale = strings.ToLower(locale)
+	if api.bundles[locale] == nil {
+		api.bundles[locale] = Bundle{}
+	}
+	for code, template := range bundle {
+		api.bundles[locale][code] = template
+	}
+	return api
+}
+
+// Locale sets the function that picks the locale of each request
+func (api *API) Locale(fn LocaleFunc) *API {
+	api.locale = fn
+	return api
+}
+
+// bundle returns the translations of the request, and its locale, or nil
+// if it should be answered in English
+func (api *API) bundle(request *Request) (Bundle, string) {
+	if len(api.bundles) == 0 {
+		return nil, ""
+	}
+	var locales []string
+	if api.locale != nil {
+		if locale := api.locale(request); locale != "" {
+			locales = []string{locale}
+		}
+	}
+	if locales == nil {
+		locales = acceptLanguages(request.Header.Get("Accept-Language"))
+	}
+
+	for _, tag := range locales {
+		locale := strings.ToLower(tag)
+		language := strings.SplitN(locale, "-", 2)[0]
+		if language == "en" {
+			return nil, ""
+		}
+		bundle, exists := api.bundles[locale]
+		base, baseExists := api.bundles[language]
+		if !exists && !baseExists {
+			continue
+		}
+		// Regional bundles fall back to their language
+		merged := Bundle{}
+		for code, template := range base {
+			merged[code] = template
+		}
+		for code, template := range bundle {
+			merged[code] = template
+		}
+		if exists {
+			return merged, tag
+		}
+		return merged, language
+	}
+	return nil, ""
+}
+
+// acceptLanguages returns the locales of an Accept-Language header in the
+// order of their quality
+func acceptLanguages(header string) []string {
+	type weighted struct {
+		locale  string
+		quality float64
+	}
+	accepted := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := strings.TrimSpace(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			accepted = append(accepted, weighted{locale, quality})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+	locales := make([]string, len(accepted))
+	for i, accept := range accepted {
+		locales[i] = accept.locale
+	}
+	return locales
+}
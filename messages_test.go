@@ -0,0 +1,91 @@
+package argo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptLanguages(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		[]string{"de-CH", "fr", "de"},
+		acceptLanguages("fr;q=0.9, de;q=0.5, de-CH, *;q=0.1, en;q=0"),
+	)
+	assert.Equal([]string{}, acceptLanguages(""))
+}
+
+func TestAPI_Translate(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New().Translate("de", Bundle{
+		CodeMissingField: "ist erforderlich",
+		CodeTooShort:     "muss mindestens {min} Zeichen lang sein",
+		CodeNotFound:     "keine Ressource mit {key} {value}",
+		CodeInvalidValue: "ist ungültig",
+		CodeRateLimited:  "zu viele Anfragen, erneut in {seconds} Sekunden",
+		CodeNotWritable:  "darf nicht geschrieben werden",
+	}).Translate("de-CH", Bundle{CodeMissingField: "isch erforderlich"})
+
+	request := func(language string) *Request {
+		r := MockRequest(nil, nil)
+		r.Header = http.Header{}
+		r.Header.Set("Accept-Language", language)
+		return r
+	}
+	bundle, locale := api.bundle(request("de-AT, en;q=0.5"))
+	assert.Equal("de", locale)
+	assert.Equal("ist erforderlich", bundle[CodeMissingField])
+
+	// Regional bundles fall back to their language
+	bundle, locale = api.bundle(request("de-CH"))
+	assert.Equal("de-CH", locale)
+	assert.Equal("isch erforderlich", bundle[CodeMissingField])
+	assert.Equal("ist ungültig", bundle[CodeInvalidValue])
+
+	bundle, _ = api.bundle(request("en, de"))
+	assert.Nil(bundle)
+	bundle, _ = api.bundle(request("fr"))
+	assert.Nil(bundle)
+
+	// A hook can pick the locale instead
+	api.Locale(func(r *Request) string { return r.Get("lang") })
+	r := request("fr")
+	r.Values.Set("lang", "de")
+	_, locale = api.bundle(r)
+	assert.Equal("de", locale)
+
+	bundle, _ = api.bundle(request("de"))
+	apiErr := MessageError(
+		404, CodeNotFound, map[string]interface{}{"key": "id", "value": "1"},
+	)
+	apiErr.AddField("name", Message(CodeMissingField, nil))
+	_, err := Validators{Length(8, 0)}.Validate("short")
+	apiErr.AddField("password", fieldErrors(err)...)
+	apiErr.AddField("age", fieldErrors(errNotString)...)
+	apiErr.AddField("role", Message(CodeNotWritable, nil))
+	apiErr.SetField("email", "is taken")
+	apiErr.SetField("nickname", "is required")
+	apiErr.localize(bundle)
+
+	assert.Equal([]string{"keine Ressource mit id 1"}, apiErr.Meta)
+	assert.Equal("ist erforderlich", apiErr.Field("name"))
+	assert.Equal("darf nicht geschrieben werden", apiErr.Field("role"))
+	assert.Equal("muss mindestens 8 Zeichen lang sein", apiErr.Field("password"))
+
+	// Messages without a translation, or that were not created by
+	// Message, stay in English even if they match the template
+	assert.Equal("must be a string", apiErr.Field("age"))
+	assert.Equal("is taken", apiErr.Field("email"))
+	assert.Equal("is required", apiErr.Field("nickname"))
+
+	// Messages are translated by code with their parameters
+	limited := MessageError(
+		429, CodeRateLimited, map[string]interface{}{"seconds": 3},
+	)
+	assert.Equal([]string{"rate limit exceeded, retry in 3 seconds"}, limited.Meta)
+	limited.localize(bundle)
+	assert.Equal([]string{"zu viele Anfragen, erneut in 3 Sekunden"}, limited.Meta)
+}
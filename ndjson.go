@@ -0,0 +1,69 @@
+package argo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	sql "github.com/aodin/aspect"
+)
+
+// NDJSON implements newline-delimited JSON encoding, one result per line.
+// Lists are always streamed, and their meta is omitted.
+type NDJSON struct{}
+
+func (c NDJSON) Encode(i interface{}) []byte {
+	var buffer bytes.Buffer
+	if err := c.EncodeTo(&buffer, i); err != nil {
+		panic(fmt.Sprintf("argo: could not NDJSON encode response: %s", err))
+	}
+	return buffer.Bytes()
+}
+
+// EncodeTo implements the StreamEncoder interface. The results of lists
+// are written one per line; any other response is written as a single
+// line.
+func (c NDJSON) EncodeTo(w io.Writer, i interface{}) error {
+	switch response := i.(type) {
+	case StreamResponse:
+		return c.WriteRows(w, response.Fields, response.Rows)
+	case MultiResponse:
+		if results, ok := response.Results.([]sql.Values); ok {
+			return c.WriteRows(w, response.fields, &valuesRows{rows: results})
+		}
+		i = response.Results
+	}
+	return c.writeLine(w, i)
+}
+
+// WriteRows implements the RowWriter interface
+func (c NDJSON) WriteRows(w io.Writer, fields []string, rows Rows) error {
+	for {
+		row, err := rows.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		if err = c.writeLine(w, row); err != nil {
+			return err
+		}
+	}
+}
+
+// writeLine writes the value and its newline in a single write, so that
+// flushed streams never end mid-line
+func (c NDJSON) writeLine(w io.Writer, i interface{}) error {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (c NDJSON) MediaType() string {
+	return "application/x-ndjson"
+}
@@ -0,0 +1,59 @@
+package argo
+
+import (
+	sql "github.com/aodin/aspect"
+)
+
+// ObjectValidator validates an entry as a whole, after each of its fields
+// has been validated. The connection can be used for lookups, such as
+// confirming that a referenced row belongs to the same organization.
+// Failures should be added to the given error as field or meta errors.
+type ObjectValidator interface {
+	ValidateObject(sql.Connection, sql.Values, *APIError)
+}
+
+// ObjectValidatorFunc allows an ordinary function to be used as an
+// ObjectValidator.
+type ObjectValidatorFunc func(sql.Connection, sql.Values, *APIError)
+
+func (f ObjectValidatorFunc) ValidateObject(conn sql.Connection, values sql.Values, err *APIError) {
+	f(conn, values, err)
+}
+
+// ValidateObject returns a Modifier that adds the given object validators
+// to the resource. They are run on both POST and PATCH: on PATCH they
+// receive the existing entry merged with the new values.
+func ValidateObject(validators ...ObjectValidator) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.objectValidators = append(
+			resource.objectValidators,
+			validators...,
+		)
+		return nil
+	})
+}
+
+// validateObject runs every object validator and returns their errors
+// together.
+func (c *ResourceSQL) validateObject(conn sql.Connection, values sql.Values) *APIError {
+	err := NewError(400).SetErrorCode(CodeInvalidField)
+	for _, validator := range c.objectValidators {
+		validator.ValidateObject(conn, values, err)
+	}
+	if err.Exists() {
+		return err
+	}
+	return nil
+}
+
+// merge returns a new values map with the updates applied over the old values
+func merge(old, updates sql.Values) sql.Values {
+	merged := make(sql.Values, len(old)+len(updates))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range updates {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,57 @@
+package argo
+
+import (
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateObject(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, edgesDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	// Edges cannot loop
+	edges := Resource(
+		FromTable(edgesDB),
+		ValidateObject(ObjectValidatorFunc(
+			func(conn sql.Connection, values sql.Values, err *APIError) {
+				if values["a"] == values["b"] {
+					err.SetField("b", "must not equal a")
+				}
+			},
+		)),
+	)
+	edges.conn = tx
+
+	_, errAPI := edges.Post(MockRequest([]byte(`{"a":1,"b":1}`), nil))
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["b"])
+
+	response, errAPI := edges.Post(MockRequest([]byte(`{"a":1,"b":2}`), nil))
+	require.Nil(t, errAPI)
+	id := response.(sql.Values)["id"].(int64)
+
+	// PATCH validates the existing entry merged with the new values
+	_, errAPI = edges.Patch(MockRequest([]byte(`{"b":1}`), nil, id))
+	require.NotNil(t, errAPI)
+	assert.NotNil(errAPI.Fields["b"])
+
+	_, errAPI = edges.Patch(MockRequest([]byte(`{"b":3}`), nil, id))
+	assert.Nil(errAPI)
+}
+
+func TestMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	old := sql.Values{"a": 1, "b": 2}
+	merged := merge(old, sql.Values{"b": 3})
+	assert.Equal(sql.Values{"a": 1, "b": 3}, merged)
+
+	// The old values are unchanged
+	assert.Equal(2, old["b"])
+}
@@ -0,0 +1,533 @@
+package argo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+	"github.com/aodin/aspect/postgres"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification that API
+// documents are written in
+const OpenAPIVersion = "3.0.3"
+
+// Schema is a schema object of an OpenAPI document
+type Schema map[string]interface{}
+
+// OpenAPIFragment is the part of an OpenAPI document that describes a
+// single resource. Paths are relative to the prefix of the API and map to
+// path item objects. Schemas are added to the components of the document.
+//
+// Fragments may refer to the components of every document: the limit,
+// offset and order parameters, and the Error response and schema.
+type OpenAPIFragment struct {
+	Paths   map[string]interface{}
+	Schemas map[string]Schema
+}
+
+// OpenAPIer is implemented by resources that describe themselves in the
+// OpenAPI document of their API. SQL resources are always described;
+// other resources added with AddRest are described only if they
+// implement this interface.
+type OpenAPIer interface {
+	OpenAPI(name string) OpenAPIFragment
+}
+
+// Info sets the title and version of the OpenAPI document
+func (api *API) Info(title, version string) *API {
+	api.title = title
+	api.version = version
+	return api
+}
+
+// ref returns a reference to a component of the document
+func ref(kind, name string) Schema {
+	return Schema{"$ref": fmt.Sprintf("#/components/%s/%s", kind, name)}
+}
+
+// columnType returns the schema of a column type, without its
+// nullability. Types that are unknown accept any value.
+func columnType(t sql.Type) (schema Schema, notNull bool) {
+	switch col := t.(type) {
+	case postgres.Serial:
+		return Schema{"type": "integer", "format": "int64"}, true
+	case sql.Integer:
+		return Schema{"type": "integer", "format": "int64"}, col.NotNull
+	case sql.Real:
+		return Schema{"type": "number", "format": "float"}, col.NotNull
+	case sql.Double:
+		return Schema{"type": "number", "format": "double"}, col.NotNull
+	case sql.Boolean:
+		return Schema{"type": "boolean"}, col.NotNull
+	case sql.String:
+		schema = Schema{"type": "string"}
+		if col.Length > 0 {
+			schema["maxLength"] = col.Length
+		}
+		return schema, col.NotNull
+	case sql.Text:
+		return Schema{"type": "string"}, col.NotNull
+	case sql.Timestamp:
+		return Schema{"type": "string", "format": "date-time"}, col.NotNull
+	case sql.Date:
+		return Schema{"type": "string", "format": "date"}, col.NotNull
+	}
+	return Schema{}, false
+}
+
+// columnSchema returns the schema of a column; nullable columns are
+// marked as such
+func columnSchema(column sql.ColumnElem) Schema {
+	schema, notNull := columnType(column.Type())
+	if !notNull {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// objectSchema returns the schema of entries with the given columns in
+// the given order. Every column is returned, so all of them are required.
+func objectSchema(names []string, columns Columns) Schema {
+	properties := Schema{}
+	for _, name := range names {
+		properties[name] = columnSchema(columns[name])
+	}
+	return Schema{
+		"type":       "object",
+		"properties": properties,
+		"required":   names,
+	}
+}
+
+// sortedNames returns the names of the columns in alphabetical order
+func sortedNames(columns Columns) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// includeSchema returns the shape of an include, or false if the include
+// is not a Many or ManyToMany include
+func includeSchema(include Include) (string, Schema, bool) {
+	switch elem := include.(type) {
+	case ManyElem:
+		if elem.asMap != nil {
+			return elem.name, Schema{
+				"type":                 "object",
+				"additionalProperties": columnSchema(elem.selects[elem.asMap.Value]),
+			}, true
+		}
+		selects := Columns{}
+		for name, column := range elem.selects {
+			if elem.showFK || name != elem.fk.Name() {
+				selects[name] = column
+			}
+		}
+		return elem.name, Schema{
+			"type":  "array",
+			"items": objectSchema(sortedNames(selects), selects),
+		}, true
+	case ManyToManyElem:
+		return elem.name, Schema{
+			"type":  "array",
+			"items": objectSchema(sortedNames(elem.selects), elem.selects),
+		}, true
+	}
+	return "", nil, false
+}
+
+// outputSchema returns the schema of the entries of the resource. Includes
+// of detail views are optional, since they are not part of lists.
+func (c *ResourceSQL) outputSchema() Schema {
+	fields := make([]string, 0, len(c.selects))
+	for _, column := range c.table.Columns() {
+		if c.selects.Has(column.Name()) {
+			fields = append(fields, column.Name())
+		}
+	}
+	schema := objectSchema(fields, c.selects)
+	properties := schema["properties"].(Schema)
+	listed := make(map[string]bool)
+	for _, include := range c.listIncludes {
+		if name, _, ok := includeSchema(include); ok {
+			listed[name] = true
+		}
+	}
+	for _, include := range c.detailIncludes {
+		name, shape, ok := includeSchema(include)
+		if !ok {
+			continue
+		}
+		if !listed[name] {
+			shape["description"] = "Included in detail views only"
+		}
+		properties[name] = shape
+	}
+	return schema
+}
+
+// inputSchema returns the schema of the payloads that create or update
+// entries of the resource. Read-only fields are never accepted, and
+// create-only fields are not accepted by updates.
+func (c *ResourceSQL) inputSchema(update bool) Schema {
+	properties := Schema{}
+	required := make([]string, 0)
+	for _, column := range c.table.Columns() {
+		name := column.Name()
+		if !c.inserts.Has(name) || (update && c.createOnly.Has(name)) {
+			continue
+		}
+		properties[name] = c.fieldSchema(column)
+		if !update && c.validator(column).IsRequired() {
+			required = append(required, name)
+		}
+	}
+	schema := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// filterOperator describes how the filter compares values
+func filterOperator(filter Filter) string {
+	switch filter.(type) {
+	case StringFilter:
+		return "ilike"
+	case EqualsFilter:
+		return "equals"
+	}
+	return "custom"
+}
+
+// listParameters returns the query parameters of lists
+func (c *ResourceSQL) listParameters() []interface{} {
+	parameters := []interface{}{
+		ref("parameters", "limit"),
+		ref("parameters", "offset"),
+		ref("parameters", "order"),
+	}
+	if c.softDelete != nil {
+		parameters = append(parameters, Schema{
+			"name":        "include_deleted",
+			"in":          "query",
+			"description": "Include entries that have been deleted",
+			"schema":      Schema{"type": "boolean"},
+		})
+	}
+	names := make([]string, 0, len(c.filters))
+	for name := range c.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := Schema{}
+		if column, exists := c.selects[name]; exists {
+			schema, _ = columnType(column.Type())
+		}
+		operator := filterOperator(c.filters[name])
+		description := "Filter by equality"
+		if operator == "ilike" {
+			description = "Filter by case-insensitive substring"
+		}
+		parameters = append(parameters, Schema{
+			"name":        name,
+			"in":          "query",
+			"description": description,
+			"schema":      schema,
+			"x-operator":  operator,
+		})
+	}
+	return parameters
+}
+
+// responses returns the responses of an operation with the given status.
+// Every error is described by the Error response of the document.
+func responses(status int, description string, schema Schema) Schema {
+	response := Schema{"description": description}
+	if schema != nil {
+		response["content"] = Schema{
+			"application/json": Schema{"schema": schema},
+		}
+	}
+	return Schema{
+		fmt.Sprint(status): response,
+		"default":          ref("responses", "Error"),
+	}
+}
+
+// requestBody returns the JSON request body of the given schema
+func requestBody(schema Schema) Schema {
+	return Schema{
+		"required": true,
+		"content": Schema{
+			"application/json": Schema{"schema": schema},
+		},
+	}
+}
+
+// OpenAPI implements the OpenAPIer interface. The entries of the resource
+// are described by the schema with its name, and their payloads by the
+// name followed by .create and .update.
+func (c *ResourceSQL) OpenAPI(name string) OpenAPIFragment {
+	entry := ref("schemas", name)
+	create := ref("schemas", name+".create")
+	update := ref("schemas", name+".update")
+
+	collection := "/" + name
+	pks := c.table.PrimaryKey()
+	keys := make([]string, len(pks))
+	keyParameters := make([]interface{}, len(pks))
+	for i, pk := range pks {
+		keys[i] = fmt.Sprintf("{%s}", pk)
+		schema, _ := columnType(c.table.C[pk].Type())
+		keyParameters[i] = Schema{
+			"name":     pk,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		}
+	}
+	item := collection + "/" + strings.Join(keys, "/")
+
+	list := Schema{
+		"type": "object",
+		"properties": Schema{
+			"meta":    ref("schemas", "Meta"),
+			"results": Schema{"type": "array", "items": entry},
+		},
+	}
+	fragment := OpenAPIFragment{
+		Paths: map[string]interface{}{
+			collection: Schema{
+				"get": Schema{
+					"operationId": "list_" + name,
+					"tags":        []string{name},
+					"parameters":  c.listParameters(),
+					"responses":   responses(http.StatusOK, "A page of entries", list),
+				},
+				"post": Schema{
+					"operationId": "create_" + name,
+					"tags":        []string{name},
+					"requestBody": requestBody(create),
+					"responses":   responses(http.StatusOK, "The created entry", entry),
+				},
+			},
+			item: Schema{
+				"parameters": keyParameters,
+				"get": Schema{
+					"operationId": "get_" + name,
+					"tags":        []string{name},
+					"responses":   responses(http.StatusOK, "The entry", entry),
+				},
+				"patch": Schema{
+					"operationId": "update_" + name,
+					"tags":        []string{name},
+					"requestBody": requestBody(update),
+					"responses":   responses(http.StatusOK, "The updated entry", entry),
+				},
+				"put": Schema{
+					"operationId": "replace_" + name,
+					"tags":        []string{name},
+					"requestBody": requestBody(create),
+					"responses":   responses(http.StatusOK, "The replaced entry", entry),
+				},
+				"delete": Schema{
+					"operationId": "delete_" + name,
+					"tags":        []string{name},
+					"responses":   responses(http.StatusNoContent, "The entry was deleted", nil),
+				},
+			},
+		},
+		Schemas: map[string]Schema{
+			name:             c.outputSchema(),
+			name + ".create": c.inputSchema(false),
+			name + ".update": c.inputSchema(true),
+		},
+	}
+
+	fragment.Paths[collection+"/schema"] = Schema{
+		"get": Schema{
+			"operationId": "schema_" + name,
+			"tags":        []string{name},
+			"responses": responses(http.StatusOK, "The JSON Schema of payloads", Schema{
+				"type": "object",
+				"properties": Schema{
+					"create": Schema{"type": "object"},
+					"update": Schema{"type": "object"},
+				},
+			}),
+		},
+	}
+
+	// Actions respond with any value
+	for _, action := range c.actions {
+		path := collection + "/" + action.Name
+		if action.Item {
+			path = item + "/" + action.Name
+		}
+		pathItem, exists := fragment.Paths[path].(Schema)
+		if !exists {
+			pathItem = Schema{}
+			if action.Item {
+				pathItem["parameters"] = keyParameters
+			}
+			fragment.Paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(action.Method)] = Schema{
+			"operationId": action.Name + "_" + name,
+			"tags":        []string{name},
+			"responses":   responses(http.StatusOK, "The result of the action", Schema{}),
+		}
+	}
+	return fragment
+}
+
+// errorSchema returns the schema of errors as the API writes them
+func (api *API) errorSchema() Schema {
+	fields := Schema{
+		"type":                 "object",
+		"additionalProperties": Schema{"type": "string"},
+	}
+	properties := Schema{
+		"meta":   Schema{"type": "array", "items": Schema{"type": "string"}},
+		"fields": fields,
+	}
+	required := []string{"meta", "fields"}
+	if api.structuredErrors {
+		fields["additionalProperties"] = Schema{
+			"type":  "array",
+			"items": ref("schemas", "FieldError"),
+		}
+		properties["code"] = Schema{"type": "string"}
+		required = append(required, "code")
+	}
+	return Schema{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// OpenAPI returns the OpenAPI document of every resource of the API
+func (api *API) OpenAPI() map[string]interface{} {
+	title, version := api.title, api.version
+	if title == "" {
+		title = "API"
+	}
+	if version == "" {
+		version = "1.0.0"
+	}
+	server := strings.TrimSuffix(api.prefix, "/")
+	if server == "" {
+		server = "/"
+	}
+
+	errorContent := Schema{
+		"application/json": Schema{"schema": ref("schemas", "Error")},
+		ProblemMediaType:   Schema{"schema": ref("schemas", "Problem")},
+	}
+	components := map[string]interface{}{
+		"parameters": Schema{
+			"limit": Schema{
+				"name":        "limit",
+				"in":          "query",
+				"description": "The maximum number of entries",
+				"schema":      Schema{"type": "integer", "minimum": 1},
+			},
+			"offset": Schema{
+				"name":        "offset",
+				"in":          "query",
+				"description": "The number of entries to skip",
+				"schema":      Schema{"type": "integer", "minimum": 0},
+			},
+			"order": Schema{
+				"name":        "order",
+				"in":          "query",
+				"description": "Comma separated fields to order by, descending if prefixed with a hyphen",
+				"schema":      Schema{"type": "string"},
+			},
+		},
+		"responses": Schema{
+			"Error": Schema{
+				"description": "An error",
+				"content":     errorContent,
+			},
+		},
+	}
+	schemas := map[string]Schema{
+		"Meta": {
+			"type": "object",
+			"properties": Schema{
+				"limit":  Schema{"type": "integer"},
+				"offset": Schema{"type": "integer"},
+			},
+		},
+		"Error": api.errorSchema(),
+		"FieldError": {
+			"type": "object",
+			"properties": Schema{
+				"code":    Schema{"type": "string"},
+				"message": Schema{"type": "string"},
+				"params":  Schema{"type": "object"},
+			},
+			"required": []string{"code", "message"},
+		},
+		"Problem": {
+			"type": "object",
+			"properties": Schema{
+				"type":     Schema{"type": "string"},
+				"title":    Schema{"type": "string"},
+				"status":   Schema{"type": "integer"},
+				"detail":   Schema{"type": "string"},
+				"instance": Schema{"type": "string"},
+				"code":     Schema{"type": "string"},
+				"fields": Schema{
+					"type": "object",
+					"additionalProperties": Schema{
+						"type":  "array",
+						"items": ref("schemas", "FieldError"),
+					},
+				},
+			},
+			"required": []string{"type", "title", "status", "code"},
+		},
+	}
+	components["schemas"] = schemas
+
+	paths := make(map[string]interface{})
+	for name, resource := range api.resources {
+		describer, ok := resource.(OpenAPIer)
+		if !ok {
+			continue
+		}
+		fragment := describer.OpenAPI(name)
+		for path, item := range fragment.Paths {
+			paths[path] = item
+		}
+		for schemaName, schema := range fragment.Schemas {
+			schemas[schemaName] = schema
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": Schema{
+			"title":   title,
+			"version": version,
+		},
+		"servers":    []Schema{{"url": server}},
+		"paths":      paths,
+		"components": components,
+	}
+}
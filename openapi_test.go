@@ -0,0 +1,121 @@
+package argo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type describedRest struct {
+	Rest
+}
+
+func (r describedRest) OpenAPI(name string) OpenAPIFragment {
+	return OpenAPIFragment{
+		Paths: map[string]interface{}{
+			"/" + name: Schema{"get": Schema{"operationId": "status"}},
+		},
+	}
+}
+
+func TestResourceSQL_OpenAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(FromTable(usersDB).Exclude("password"), CreateOnly("name"))
+	fragment := users.OpenAPI("users")
+
+	entry := fragment.Schemas["users"]
+	assert.Equal(
+		[]string{"id", "name", "age", "is_active", "created"},
+		entry["required"],
+	)
+	properties := entry["properties"].(Schema)
+	assert.Equal(Schema{"type": "integer", "format": "int64"}, properties["id"])
+	assert.Equal(
+		Schema{"type": "string", "format": "date-time", "nullable": true},
+		properties["created"],
+	)
+	assert.NotContains(properties, "password")
+
+	create := fragment.Schemas["users.create"]
+	assert.Equal([]string{"name", "age", "password"}, create["required"])
+	assert.NotContains(create["properties"], "id")
+	update := fragment.Schemas["users.update"]
+	assert.NotContains(update, "required")
+	assert.NotContains(update["properties"], "name")
+
+	assert.Contains(fragment.Paths, "/users")
+	assert.Contains(fragment.Paths, "/users/{id}")
+	list := fragment.Paths["/users"].(Schema)["get"].(Schema)
+	assert.Contains(list["parameters"], Schema{
+		"name":        "name",
+		"in":          "query",
+		"description": "Filter by case-insensitive substring",
+		"schema":      Schema{"type": "string"},
+		"x-operator":  "ilike",
+	})
+
+	// Includes are described by the columns of their tables
+	companies := Resource(FromTable(companyDB), Many("contacts", contactsDB).DetailOnly())
+	contacts := companies.OpenAPI("companies").Schemas["companies"]["properties"].(Schema)["contacts"].(Schema)
+	assert.Equal("array", contacts["type"])
+	assert.Equal("Included in detail views only", contacts["description"])
+	assert.Equal(
+		[]string{"id", "key", "value"},
+		contacts["items"].(Schema)["required"],
+	)
+}
+
+func TestGuarded_OpenAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	// Guarded resources are described if the resource is
+	fragment := Guard(describedRest{}).OpenAPI("status")
+	assert.Contains(fragment.Paths, "/status")
+	assert.Equal(0, len(Guard(mockResource{}).OpenAPI("things").Paths))
+}
+
+func TestAPI_OpenAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New().Info("Example", "2.0.0").SetPrefix("/v1/")
+	require.Nil(t, api.Add(Resource(FromTable(usersDB))))
+	require.Nil(t, api.AddRest("status", describedRest{}))
+	require.Nil(t, api.AddRest("health", Guard(describedRest{})))
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/openapi.json")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+
+	var document struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Servers    []map[string]string        `json:"servers"`
+		Paths      map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&document))
+	assert.Equal(OpenAPIVersion, document.OpenAPI)
+	assert.Equal("Example", document.Info.Title)
+	assert.Equal("/v1", document.Servers[0]["url"])
+	assert.Contains(document.Paths, "/users")
+	assert.Contains(document.Paths, "/users/{id}")
+	assert.Contains(document.Paths, "/status")
+	assert.Contains(document.Paths, "/health")
+	assert.Contains(document.Components.Schemas, "users.create")
+	assert.Contains(document.Components.Schemas, "Error")
+	assert.Contains(document.Components.Schemas, "Problem")
+}
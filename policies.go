@@ -0,0 +1,71 @@
+package argo
+
+import (
+	"fmt"
+)
+
+// ReadOnly returns a Modifier that removes the given fields from the
+// columns that can be written. The fields are still returned to clients,
+// but any attempt to write them is a field error.
+func ReadOnly(names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			column, exists := resource.table.C[name]
+			if !exists {
+				return fmt.Errorf(
+					"argo: cannot make '%s' read-only, table '%s' does not have a column with this name",
+					name,
+					resource.table.Name,
+				)
+			}
+			// The field may have already been removed, such as a primary key
+			resource.inserts.Remove(name)
+			resource.readOnly.Add(column)
+		}
+		return nil
+	})
+}
+
+// WriteOnly returns a Modifier that accepts the given fields on writes
+// but never returns them to clients. They cannot be filtered or ordered by.
+func WriteOnly(names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			if !resource.inserts.Has(name) {
+				return fmt.Errorf(
+					"argo: cannot make '%s' write-only, it is not a writable field of '%s'",
+					name,
+					resource.Name,
+				)
+			}
+			if err := resource.selects.Remove(name); err != nil {
+				return fmt.Errorf(
+					"argo: cannot make '%s' write-only, it is not a selected field of '%s'",
+					name,
+					resource.Name,
+				)
+			}
+			delete(resource.filters, name)
+		}
+		return nil
+	})
+}
+
+// CreateOnly returns a Modifier that allows the given fields to be set
+// when an entry is created, but not changed afterwards.
+func CreateOnly(names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			column, exists := resource.inserts[name]
+			if !exists {
+				return fmt.Errorf(
+					"argo: cannot make '%s' create-only, it is not a writable field of '%s'",
+					name,
+					resource.Name,
+				)
+			}
+			resource.createOnly.Add(column)
+		}
+		return nil
+	})
+}
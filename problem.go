@@ -0,0 +1,75 @@
+package argo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ProblemMediaType is the media type of RFC 7807 problem details
+const ProblemMediaType = "application/problem+json"
+
+// Problem is the RFC 7807 representation of an APIError. Its type is the
+// error code resolved against the base URI of the API, or about:blank if
+// there is none. The error code and the structured errors of fields are
+// extension members.
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Code     string                  `json:"code"`
+	Fields   map[string][]FieldError `json:"fields,omitempty"`
+}
+
+// Problem converts the error into problem details. The instance is the
+// path of the request that failed.
+func (e APIError) Problem(base, instance string) Problem {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(e.code),
+		Status:   e.code,
+		Detail:   strings.Join(e.Meta, "; "),
+		Instance: instance,
+		Code:     e.ErrorCode(),
+		Fields:   e.structuredFields(),
+	}
+	if base != "" {
+		problem.Type = base + problem.Code
+	}
+	return problem
+}
+
+// WriteProblem writes the error as problem details
+func (e APIError) WriteProblem(w http.ResponseWriter, base, instance string) {
+	b, err := json.Marshal(e.Problem(base, instance))
+	if err != nil {
+		panic(fmt.Sprintf("argo: could not encode problem details: %s", err))
+	}
+	w.Header().Set("Content-Type", ProblemMediaType)
+	w.WriteHeader(e.code)
+	w.Write(b)
+}
+
+// ProblemDetails writes every error of the API as RFC 7807 problem
+// details. The types of problems are their error codes resolved against
+// the given base URI, such as https://example.com/errors/. Clients may
+// also request problem details with their Accept header.
+func (api *API) ProblemDetails(base string) *API {
+	api.problems = true
+	api.problemBase = base
+	return api
+}
+
+// acceptsProblems returns true if the request accepts problem details
+func acceptsProblems(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		if mediaType == ProblemMediaType {
+			return true
+		}
+	}
+	return false
+}
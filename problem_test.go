@@ -0,0 +1,74 @@
+package argo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIError_ErrorCode(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(CodeNotFound, MetaError(404, "missing").ErrorCode())
+	assert.Equal(CodeInternal, MetaError(500, "broken").ErrorCode())
+	assert.Equal(
+		CodeDuplicate,
+		NewError(400).SetErrorCode(CodeDuplicate).ErrorCode(),
+	)
+
+	apiErr := NewError(400).SetErrorCode(CodeMissingField)
+	apiErr.SetField("name", "is required")
+	assert.Equal(Problem{
+		Type:     "https://example.com/errors/missing_field",
+		Title:    "Bad Request",
+		Status:   400,
+		Instance: "/users",
+		Code:     CodeMissingField,
+		Fields: map[string][]FieldError{
+			"name": {{Code: CodeMissingField, Message: "is required"}},
+		},
+	}, apiErr.Problem("https://example.com/errors/", "/users"))
+	assert.Equal("about:blank", apiErr.Problem("", "/users").Type)
+}
+
+func TestAPI_ProblemDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New()
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	// Errors are written with the media type of their encoder
+	resp, err := http.Get(ts.URL + "/missing")
+	require.Nil(t, err)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	resp.Body.Close()
+
+	// Clients can request problem details
+	request, _ := http.NewRequest("GET", ts.URL+"/missing", nil)
+	request.Header.Set("Accept", "application/problem+json")
+	resp, err = http.DefaultClient.Do(request)
+	require.Nil(t, err)
+	assert.Equal(ProblemMediaType, resp.Header.Get("Content-Type"))
+	var problem Problem
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&problem))
+	resp.Body.Close()
+	assert.Equal("about:blank", problem.Type)
+	assert.Equal(404, problem.Status)
+	assert.Equal(CodeNotFound, problem.Code)
+	assert.Equal("/missing", problem.Instance)
+
+	// Or the API can always write them
+	api.ProblemDetails("https://example.com/errors/")
+	resp, err = http.Get(ts.URL + "/missing")
+	require.Nil(t, err)
+	assert.Equal(ProblemMediaType, resp.Header.Get("Content-Type"))
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&problem))
+	resp.Body.Close()
+	assert.Equal("https://example.com/errors/not_found", problem.Type)
+}
@@ -0,0 +1,265 @@
+package argo
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit is the configuration of a token bucket. Buckets hold at most Burst
+// tokens and are refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// check panics if the limit could never refill its bucket, which would
+// make clients wait forever
+func (limit Limit) check() Limit {
+	if !(limit.Rate > 0) || math.IsInf(limit.Rate, 1) {
+		panic(fmt.Sprintf("argo: the rate of a limit must be positive, not %v", limit.Rate))
+	}
+	if !(limit.Burst >= 1) {
+		panic(fmt.Sprintf("argo: the burst of a limit must be at least 1, not %v", limit.Burst))
+	}
+	return limit
+}
+
+// PerSecond allows n requests per second with the given burst
+func PerSecond(n, burst int) Limit {
+	return Limit{Rate: float64(n), Burst: float64(burst)}
+}
+
+// PerMinute allows n requests per minute, all of which may be made at once
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: float64(n)}
+}
+
+// RateLimitStore keeps the token buckets of rate limited clients. Take
+// removes cost tokens from the bucket of the key, which starts full. It
+// returns the tokens remaining and, if there were not enough tokens, how
+// long the client should wait before retrying.
+type RateLimitStore interface {
+	Take(key string, limit Limit, cost float64, now time.Time) (remaining float64, wait time.Duration, ok bool)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// refill adds the tokens earned since the last update
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.limit.Burst, b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+}
+
+// MemoryStore is an in-process RateLimitStore. It is not shared between
+// instances of a server.
+type MemoryStore struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+// memorySweep is the number of takes between removals of full buckets
+const memorySweep = 1024
+
+// Take implements the RateLimitStore interface
+func (store *MemoryStore) Take(key string, limit Limit, cost float64, now time.Time) (float64, time.Duration, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	if store.takes++; store.takes%memorySweep == 0 {
+		store.sweep(now)
+	}
+
+	b, exists := store.buckets[key]
+	if !exists {
+		b = &bucket{tokens: limit.Burst, updated: now}
+		store.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	if b.tokens < cost {
+		wait := time.Duration((cost - b.tokens) / limit.Rate * float64(time.Second))
+		return b.tokens, wait, false
+	}
+	b.tokens -= cost
+	return b.tokens, 0, true
+}
+
+// sweep removes full buckets, which are the same as missing ones
+func (store *MemoryStore) sweep(now time.Time) {
+	for key, b := range store.buckets {
+		if b.refill(now); b.tokens >= b.limit.Burst {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+// NewMemoryStore creates an empty in-memory rate limit store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// ClientKey identifies the client of a request by its authenticated
+// principal, or else its IP address. Unverified credentials, such as the
+// X-API-Key header, are never used, since clients could change them to get
+// a new bucket.
+func ClientKey(r *Request) string {
+	if r.Principal != nil && r.Principal.ID != "" {
+		return "principal:" + r.Principal.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// LimitCost weighs GET requests by their limit parameter, so that each
+// started page of the given size costs a token. Exports, which stream
+// every row, cost the whole burst of the bucket. All other requests cost
+// a single token.
+func LimitCost(pageSize int) func(*Request) float64 {
+	return func(r *Request) float64 {
+		if method(r.Method) != GET {
+			return 1
+		}
+		if r.Get("export") == "true" {
+			return math.Inf(1)
+		}
+		limit, err := strconv.Atoi(r.Get("limit"))
+		if err != nil || limit <= pageSize {
+			return 1
+		}
+		return math.Ceil(float64(limit) / float64(pageSize))
+	}
+}
+
+// RateLimiter limits the requests of each client to an API with token
+// buckets. Limits can be set for all resources, per resource, and per
+// resource and method; the most specific limit applies, and each limit
+// has its own bucket.
+type RateLimiter struct {
+	store        RateLimitStore
+	key          func(*Request) string
+	cost         func(*Request) float64
+	defaultLimit *Limit
+	limits       map[string]Limit
+	now          func() time.Time
+}
+
+// Resource sets the limit of all methods of the named resource. Limits
+// must have a positive rate and a burst of at least one.
+func (rl *RateLimiter) Resource(name string, limit Limit) *RateLimiter {
+	rl.limits[name] = limit.check()
+	return rl
+}
+
+// Method sets the limit of a single method of the named resource. GET
+// limits cover both List and Get.
+func (rl *RateLimiter) Method(name string, m method, limit Limit) *RateLimiter {
+	rl.limits[name+" "+string(m)] = limit.check()
+	return rl
+}
+
+// Store replaces the in-memory store of token buckets
+func (rl *RateLimiter) Store(store RateLimitStore) *RateLimiter {
+	rl.store = store
+	return rl
+}
+
+// Key sets the function that identifies clients. It defaults to ClientKey.
+func (rl *RateLimiter) Key(key func(*Request) string) *RateLimiter {
+	rl.key = key
+	return rl
+}
+
+// Cost sets the function that weighs requests. It defaults to LimitCost
+// with pages of 100.
+func (rl *RateLimiter) Cost(cost func(*Request) float64) *RateLimiter {
+	rl.cost = cost
+	return rl
+}
+
+// limit returns the bucket name and limit of requests to the resource
+func (rl *RateLimiter) limit(name string, m method) (string, *Limit) {
+	if m == OPTIONS {
+		return "", nil
+	}
+	bucket := name + " " + string(m)
+	if limit, exists := rl.limits[bucket]; exists {
+		return bucket, &limit
+	}
+	if limit, exists := rl.limits[name]; exists {
+		return name, &limit
+	}
+	return "", rl.defaultLimit
+}
+
+// allow takes the cost of the request from the client's bucket and sets
+// the RateLimit headers of the response
+func (rl *RateLimiter) allow(r *Request, name string) *APIError {
+	key := rl.key(r)
+	bucket, limit := rl.limit(name, method(r.Method))
+	if limit == nil {
+		return nil
+	}
+	// Requests that cost more than the burst could never be made
+	cost := math.Min(rl.cost(r), limit.Burst)
+
+	remaining, wait, ok := rl.store.Take(
+		key+"|"+bucket, *limit, cost, rl.now(),
+	)
+	reset := (limit.Burst - remaining) / limit.Rate
+
+	header := r.ResponseHeader()
+	header.Set("RateLimit-Limit", strconv.Itoa(int(limit.Burst)))
+	header.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset))))
+	if ok {
+		return nil
+	}
+	retry := int(math.Ceil(wait.Seconds()))
+	header.Set("Retry-After", strconv.Itoa(retry))
+	return MessageError(
+		429, CodeRateLimited, map[string]interface{}{"seconds": retry},
+	)
+}
+
+// RateLimit creates a rate limiter with an in-memory store. The given
+// limit applies to every resource without a more specific limit; it may
+// be empty, in which case only resources with limits are limited.
+func RateLimit(limits ...Limit) *RateLimiter {
+	rl := &RateLimiter{
+		store:  NewMemoryStore(),
+		key:    ClientKey,
+		cost:   LimitCost(100),
+		limits: make(map[string]Limit),
+		now:    time.Now,
+	}
+	if len(limits) > 0 {
+		limit := limits[0].check()
+		rl.defaultLimit = &limit
+	}
+	return rl
+}
+
+// RateLimit sets the rate limiter of the API. Authenticated requests are
+// limited by their principal, so that principals have their own buckets
+// even behind a shared address. Anonymous requests, and requests that
+// fail authentication, are limited by their IP address.
+func (api *API) RateLimit(limiter *RateLimiter) *API {
+	api.limiter = limiter
+	return api
+}
@@ -0,0 +1,182 @@
+package argo
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryStore()
+	limit := PerSecond(1, 2)
+	now := time.Unix(0, 0)
+
+	remaining, _, ok := store.Take("a", limit, 1, now)
+	assert.True(ok)
+	assert.Equal(1.0, remaining)
+
+	_, _, ok = store.Take("a", limit, 1, now)
+	assert.True(ok)
+
+	// The bucket is empty
+	remaining, wait, ok := store.Take("a", limit, 1, now)
+	assert.False(ok)
+	assert.Equal(0.0, remaining)
+	assert.Equal(time.Second, wait)
+
+	// Other keys have their own buckets
+	_, _, ok = store.Take("b", limit, 2, now)
+	assert.True(ok)
+
+	// Buckets are refilled over time, up to their burst
+	_, _, ok = store.Take("a", limit, 1, now.Add(time.Second))
+	assert.True(ok)
+	remaining, _, ok = store.Take("a", limit, 1, now.Add(time.Hour))
+	assert.True(ok)
+	assert.Equal(1.0, remaining)
+}
+
+func TestLimit_Check(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NotPanics(func() { RateLimit(PerMinute(1)) })
+	assert.NotPanics(func() { RateLimit() })
+
+	// Limits that never refill, or that never allow a request, are
+	// rejected when they are set
+	assert.Panics(func() { RateLimit(PerMinute(0)) })
+	assert.Panics(func() { RateLimit(Limit{Rate: -1, Burst: 1}) })
+	assert.Panics(func() { RateLimit().Resource("things", Limit{Burst: 1}) })
+	assert.Panics(func() { RateLimit().Method("things", GET, PerSecond(1, 0)) })
+}
+
+func TestLimitCost(t *testing.T) {
+	assert := assert.New(t)
+	cost := LimitCost(100)
+
+	get := func(limit string) *Request {
+		r := MockRequest(nil, url.Values{"limit": []string{limit}})
+		r.Method = "GET"
+		return r
+	}
+	assert.Equal(1.0, cost(get("")))
+	assert.Equal(1.0, cost(get("100")))
+	assert.Equal(2.0, cost(get("101")))
+	assert.Equal(100.0, cost(get("10000")))
+
+	post := get("10000")
+	post.Method = "POST"
+	assert.Equal(1.0, cost(post))
+
+	// Exports cost the whole burst
+	export := get("")
+	export.Values.Set("export", "true")
+	assert.True(math.IsInf(cost(export), 1))
+}
+
+func TestAPI_RateLimitAuthentication(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{"valid": &Principal{ID: "1"}}
+	api := New().Authenticate(APIKey(keys)).RateLimit(RateLimit(PerMinute(2)))
+	api.AddRest("things", mockResource{}, "id")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	do := func(key string) int {
+		req, _ := http.NewRequest("GET", ts.URL+"/things", nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Failed logins are limited by address, whatever key they send
+	assert.Equal(http.StatusUnauthorized, do("a"))
+	assert.Equal(http.StatusUnauthorized, do("b"))
+	assert.Equal(http.StatusTooManyRequests, do("c"))
+
+	// Authenticated clients have their own bucket, even once their
+	// address is limited
+	assert.Equal(http.StatusNoContent, do("valid"))
+	assert.Equal(http.StatusNoContent, do("valid"))
+	assert.Equal(http.StatusTooManyRequests, do("valid"))
+}
+
+func TestAPI_RateLimitPrincipal(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{"valid": &Principal{ID: "1"}}
+	api := New().Authenticate(APIKey(keys)).RateLimit(RateLimit(PerMinute(2)))
+	api.AddRest("news", publicResource{}, "id")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	do := func(key string) int {
+		req, _ := http.NewRequest("GET", ts.URL+"/news", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Anonymous clients at the same address use up its bucket
+	assert.Equal(http.StatusNoContent, do(""))
+	assert.Equal(http.StatusNoContent, do(""))
+	assert.Equal(http.StatusTooManyRequests, do(""))
+
+	// Authenticated clients behind the address are not charged to it
+	assert.Equal(http.StatusNoContent, do("valid"))
+	assert.Equal(http.StatusNoContent, do("valid"))
+	assert.Equal(http.StatusTooManyRequests, do("valid"))
+}
+
+func TestAPI_RateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := RateLimit(PerMinute(2)).Method("things", POST, PerMinute(1))
+	api := New().RateLimit(limiter)
+	api.AddRest("things", mockResource{}, "id")
+	api.AddRest("others", mockResource{}, "id")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/things")
+	require.Nil(t, err)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Equal("2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal("1", resp.Header.Get("RateLimit-Remaining"))
+
+	// Large pages cost more, at most the whole burst
+	resp, err = http.Get(ts.URL + "/others?limit=1000")
+	require.Nil(t, err)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal("30", resp.Header.Get("Retry-After"))
+
+	resp, err = http.Get(ts.URL + "/things/1")
+	require.Nil(t, err)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Equal("0", resp.Header.Get("RateLimit-Remaining"))
+
+	// Methods with their own limit have their own bucket
+	resp, err = http.Post(ts.URL+"/things", "application/json", nil)
+	require.Nil(t, err)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/things", "application/json", nil)
+	require.Nil(t, err)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal("60", resp.Header.Get("Retry-After"))
+}
@@ -4,20 +4,53 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	sql "github.com/aodin/aspect"
 )
 
 // TODO A Request constructor function
 
-// GetEncoder matches the request Accept-Encoding header with an Encoder.
+// GetEncoder matches the request's format query parameter, or else its
+// Accept header, with an Encoder. JSON is the default.
 // TODO this could be done with routes / headers / auth
 func GetEncoder(r *http.Request) Encoder {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return CSV{}
+	case "json":
+		return JSON{}
+	case "ndjson":
+		return NDJSON{}
+	case "jsonapi":
+		return JSONAPI{}
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		switch mediaType {
+		case "text/csv":
+			return CSV{}
+		case "application/json":
+			return JSON{}
+		case "application/x-ndjson":
+			return NDJSON{}
+		case "text/event-stream":
+			return SSE{}
+		case "application/vnd.api+json":
+			return JSONAPI{}
+		}
+	}
 	return JSON{}
 }
 
 // GetDecoder matches the request Content-Type header with a Decoder.
 func GetDecoder(r *http.Request) Decoder {
+	mediaType := strings.TrimSpace(
+		strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0],
+	)
+	if mediaType == "application/vnd.api+json" {
+		return JSONAPI{}
+	}
 	return JSON{}
 }
 
@@ -27,6 +60,20 @@ type Request struct {
 	Decoding Decoder
 	Params   Params
 	Values   url.Values
+
+	// Tx is the transaction of the current write request. It is set by
+	// ResourceSQL for the duration of Post, Patch, Put, Delete and custom
+	// actions, such as restore and import, so that hooks and actions can
+	// run their queries inside it.
+	Tx sql.Transaction
+
+	// Principal is the authenticated caller, or nil if the request is
+	// anonymous. It is set by the authenticators of the API.
+	Principal *Principal
+
+	header  http.Header                 // Headers that will be written with the response
+	scopes  map[*ResourceSQL]sql.Values // Scopes of the resources, see Scope
+	commits []func()                    // Called once the transaction is committed
 }
 
 func (r *Request) Decode(data io.Reader) (sql.Values, *APIError) {
@@ -34,7 +81,26 @@ func (r *Request) Decode(data io.Reader) (sql.Values, *APIError) {
 		// Default to JSON if no decoder was specified
 		r.Decoding = JSON{}
 	}
-	return r.Decoding.Decode(data)
+	values, err := r.Decoding.Decode(data)
+	if err != nil && r.bodyTooLarge() {
+		return nil, MessageError(413, CodeBodyTooLarge, nil)
+	}
+	return values, err
+}
+
+// onCommit calls the function once the transaction of the request has
+// been committed. It is never called if the transaction is rolled back.
+func (r *Request) onCommit(fn func()) {
+	r.commits = append(r.commits, fn)
+}
+
+// committed calls the functions waiting for the commit
+func (r *Request) committed() {
+	fns := r.commits
+	r.commits = nil
+	for _, fn := range fns {
+		fn()
+	}
 }
 
 // Get gets a GET parameter and ONLY a get parameter - never POST form data
@@ -42,6 +108,15 @@ func (r *Request) Get(key string) string {
 	return r.QueryValues().Get(key)
 }
 
+// ResponseHeader returns the headers that will be written with the
+// response, including error responses.
+func (r *Request) ResponseHeader() http.Header {
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	return r.header
+}
+
 func (r *Request) QueryValues() url.Values {
 	if r.Values == nil {
 		r.Values = r.Request.URL.Query()
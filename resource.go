@@ -2,6 +2,7 @@ package argo
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -18,6 +19,30 @@ type Include interface {
 	QueryAll(sql.Connection, []sql.Values) error
 }
 
+// RequestIncluder is implemented by includes that depend on the request,
+// such as those that honor include_deleted. Resources use its methods
+// instead of those of Include.
+type RequestIncluder interface {
+	QueryRequest(*Request, sql.Connection, sql.Values) error
+	QueryAllRequest(*Request, sql.Connection, []sql.Values) error
+}
+
+// queryInclude adds the include to a single entry
+func queryInclude(include Include, r *Request, conn sql.Connection, values sql.Values) error {
+	if includer, ok := include.(RequestIncluder); ok {
+		return includer.QueryRequest(r, conn, values)
+	}
+	return include.Query(conn, values)
+}
+
+// queryAllIncludes adds the include to every entry of a list
+func queryAllIncludes(include Include, r *Request, conn sql.Connection, values []sql.Values) error {
+	if includer, ok := include.(RequestIncluder); ok {
+		return includer.QueryAllRequest(r, conn, values)
+	}
+	return include.QueryAll(conn, values)
+}
+
 // ResourceSQL is the internal representation of a REST resource backed by SQL.
 type ResourceSQL struct {
 	Name    string
@@ -27,6 +52,13 @@ type ResourceSQL struct {
 	inserts Columns
 	fields  map[string]Validator
 
+	// Object validators are run after all fields have been validated
+	objectValidators []ObjectValidator
+
+	// Field policies
+	readOnly   Columns // Returned but never written
+	createOnly Columns // Written on create but never updated
+
 	// Includes
 	listIncludes   []Include
 	detailIncludes []Include
@@ -37,8 +69,50 @@ type ResourceSQL struct {
 	order   []sql.Orderable // Default ordering is the pks ascending
 	filters map[string]Filter
 
+	// Uniqueness rules checked before writes
+	uniques []UniqueElem
+
+	// Lifecycle hooks
+	hooks hooks
+
+	// Optimistic concurrency
+	version        string // Column that entity tags are derived from
+	requireIfMatch bool
+
+	// Row-level scoping
+	scope ScopeFunc
+
+	// Public resources can be requested without credentials
+	public bool
+
+	// Maximum size of request bodies, or zero for the limit of the API
+	maxBodySize int64
+
+	// Lists are written as they are scanned if the encoder can stream
+	stream bool
+
+	// Event streams of lists, see Events
+	events *EventsElem
+
+	// Authorization policies by method and by field
+	policies      map[method][]Policy
+	readPolicies  map[string][]Policy
+	writePolicies map[string][]Policy
+
+	// Soft deletes mark rows as deleted instead of removing them
+	softDelete *softDelete
+
+	// Target resources of foreign keys, by column
+	references map[string]*ResourceSQL
+
+	// Custom actions
+	actions []Action
+
+	// Caching of GET responses
+	lastModified string // Timestamp column of the Last-Modified header
+	cacheControl string
+
 	// TODO save pk columns
-	// TODO Unique and foreign keys that must be checked
 }
 
 // parseMeta parses the GET variables of the request and creates a Meta object
@@ -47,8 +121,12 @@ type ResourceSQL struct {
 func (c *ResourceSQL) parseMeta(r *Request) (meta Meta) {
 	var err error
 
-	// Get all request parameters
-	values := r.QueryValues()
+	// Copy the request parameters, since the request keeps its own for
+	// includes and encoders, such as include_deleted
+	values := url.Values{}
+	for key, value := range r.QueryValues() {
+		values[key] = value
+	}
 
 	// TODO there should be limit max
 	meta.Limit, err = strconv.Atoi(values.Get("limit"))
@@ -70,7 +148,10 @@ func (c *ResourceSQL) parseMeta(r *Request) (meta Meta) {
 		delete(values, "offset")
 	}
 
-	meta.order = c.parseOrder(r.Get("order"))
+	// Fields the request may not read cannot be ordered or filtered by
+	selects := c.readable(r)
+	meta.sort = c.parseSort(r.Get("order"), selects)
+	meta.order = orderBy(meta.sort)
 	if len(meta.order) < 1 {
 		// Fallback to default (primary keys ascending)
 		meta.order = c.order
@@ -80,6 +161,14 @@ func (c *ResourceSQL) parseMeta(r *Request) (meta Meta) {
 		delete(values, "order")
 	}
 
+	if _, ok = values["include_deleted"]; ok {
+		delete(values, "include_deleted")
+	}
+
+	// Response formats and exports are handled by the encoder
+	delete(values, "format")
+	delete(values, "export")
+
 	// Perform default filtering on the remaining fields
 	for k, _ := range values {
 		// The values of query values are slices, just get the first
@@ -93,6 +182,9 @@ func (c *ResourceSQL) parseMeta(r *Request) (meta Meta) {
 		if filter, ok = c.filters[k]; !ok {
 			continue
 		}
+		if _, restricted := c.readPolicies[k]; restricted && !selects.Has(k) {
+			continue
+		}
 		meta.filters = append(meta.filters, filter.Filter(v))
 	}
 
@@ -101,10 +193,33 @@ func (c *ResourceSQL) parseMeta(r *Request) (meta Meta) {
 	return
 }
 
+// sortKey is a column of the order of a list
+type sortKey struct {
+	column sql.ColumnElem
+	desc   bool
+}
+
+// orderBy returns the sort keys as orderables
+func orderBy(keys []sortKey) (order []sql.Orderable) {
+	for _, key := range keys {
+		if key.desc {
+			order = append(order, key.column.Desc())
+		} else {
+			order = append(order, key.column.Asc())
+		}
+	}
+	return
+}
+
 // parseOrder: field names are separated by commas, descending is
 // marked by hyphens.
 // TODO Sean hates this.
-func (c *ResourceSQL) parseOrder(get string) (order []sql.Orderable) {
+func (c *ResourceSQL) parseOrder(get string, selects Columns) []sql.Orderable {
+	return orderBy(c.parseSort(get, selects))
+}
+
+// parseSort parses the order of a list as sort keys
+func (c *ResourceSQL) parseSort(get string, selects Columns) (keys []sortKey) {
 	parts := strings.Split(get, ",")
 	for _, part := range parts {
 		var desc bool
@@ -115,31 +230,48 @@ func (c *ResourceSQL) parseOrder(get string) (order []sql.Orderable) {
 		}
 
 		// TODO columns can't start with a hyphen
-		column, exists := c.table.C[part]
+		// Only selected columns can be ordered by
+		column, exists := selects[part]
 		if !exists {
 			continue
 		}
-		if desc {
-			order = append(order, column.Desc())
-		} else {
-			order = append(order, column.Asc())
-		}
+		keys = append(keys, sortKey{column: column, desc: desc})
 	}
 	return
 }
 
+// Validate validates and cleans the values of a new entry. Errors for
+// every invalid field are returned together.
 func (c *ResourceSQL) Validate(values sql.Values) *APIError {
+	return c.validate(values, false)
+}
+
+// ValidateUpdate validates and cleans the values of an update to an
+// existing entry. Create-only fields cannot be updated.
+func (c *ResourceSQL) ValidateUpdate(values sql.Values) *APIError {
+	return c.validate(values, true)
+}
+
+func (c *ResourceSQL) validate(values sql.Values, update bool) *APIError {
 	// Create an empty error scaffold
-	err := NewError(400)
+	err := NewError(400).SetErrorCode(CodeInvalidField)
 	for key, value := range values {
 		column, exists := c.inserts[key]
 		if !exists {
-			err.SetField(key, "does not exist")
+			if c.readOnly.Has(key) {
+				err.AddField(key, Message(CodeReadOnly, nil))
+			} else {
+				err.AddField(key, Message(CodeUnknownField, nil))
+			}
+			continue
+		}
+		if update && c.createOnly.Has(key) {
+			err.AddField(key, Message(CodeCreateOnly, nil))
 			continue
 		}
-		clean, validateErr := column.Type().Validate(value)
+		clean, validateErr := c.validator(column).Validate(value)
 		if validateErr != nil {
-			err.SetField(column.Name(), validateErr.Error())
+			err.AddField(column.Name(), typeErrors(column.Type(), value, validateErr)...)
 			continue
 		}
 		values[key] = clean
@@ -152,12 +284,12 @@ func (c *ResourceSQL) Validate(values sql.Values) *APIError {
 
 func (c *ResourceSQL) HasRequired(values sql.Values) *APIError {
 	// TODO use an existing error scaffold?
-	err := NewError(400)
+	err := NewError(400).SetErrorCode(CodeMissingField)
 	for _, column := range c.inserts {
 		// TODO precompute required fields
-		if column.Type().IsRequired() {
+		if c.validator(column).IsRequired() {
 			if _, exists := values[column.Name()]; !exists {
-				err.SetField(column.Name(), "is required")
+				err.AddField(column.Name(), Message(CodeMissingField, nil))
 			}
 		}
 	}
@@ -169,14 +301,41 @@ func (c *ResourceSQL) HasRequired(values sql.Values) *APIError {
 
 // List returns the collection view of this sql resource.
 func (c *ResourceSQL) List(r *Request) (Response, *APIError) {
+	if apiErr := c.authorize(r, GET, nil); apiErr != nil {
+		return nil, apiErr
+	}
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
 	// Parse meta information for limit, offset, and order
+	export := r.Get("export") == "true"
 	meta := c.parseMeta(r)
+
+	filters := append(meta.filters, scopeClauses(c.table, scope)...)
+	if c.softDelete != nil && !c.includeDeleted(r) {
+		filters = append(filters, c.softDelete.visible())
+	}
+	if export {
+		return c.export(r, meta, filters)
+	}
+	switch r.Encoding.(type) {
+	case SSE:
+		return c.eventStream(r, meta, filters)
+	case NDJSON:
+		return c.streamList(r, meta, filters)
+	case StreamEncoder:
+		if c.stream {
+			return c.streamList(r, meta, filters)
+		}
+	}
+
 	stmt := sql.Select(
-		c.selects,
+		c.readable(r),
 	).OrderBy(meta.order...).Offset(meta.Offset).Limit(meta.Limit)
-
-	if len(meta.filters) > 0 {
-		stmt = stmt.Where(sql.AllOf(meta.filters...))
+	if len(filters) > 0 {
+		stmt = stmt.Where(sql.AllOf(filters...))
 	}
 
 	results := make([]sql.Values, 0)
@@ -191,27 +350,48 @@ func (c *ResourceSQL) List(r *Request) (Response, *APIError) {
 
 	// Add the includes
 	for _, include := range c.listIncludes {
-		if dbErr := include.QueryAll(c.conn, results); dbErr != nil {
+		if dbErr := queryAllIncludes(include, r, c.conn, results); dbErr != nil {
 			panic(fmt.Sprintf(
-				"argo: could not query all includes in sql resource list (%s): %s",
+				"argo: could not query all includes in sql resource list: %s",
 				dbErr,
 			))
 		}
 	}
 
-	return MultiResponse{Meta: meta, Results: results}, nil
+	// Respond before encoding if the client's copy is current
+	if c.setCacheHeaders(r, c.listETag(results), c.modified(results...)) {
+		return NotModified{}, nil
+	}
+
+	if apiErr = runHooks(c.hooks.afterRead, r, results...); apiErr != nil {
+		return nil, apiErr
+	}
+	return MultiResponse{
+		Meta:    meta,
+		Results: results,
+		fields:  c.rowFields(r, c.fieldOrder(r)),
+	}, nil
 }
 
+// Post creates a new entry in the resource's table. All queries are
+// performed in a single transaction.
 func (c *ResourceSQL) Post(r *Request) (Response, *APIError) {
+	return c.atomic(r, c.post)
+}
+
+func (c *ResourceSQL) post(r *Request) (Response, *APIError) {
 	values, apiErr := r.Decode(r.Body)
 	if apiErr != nil {
 		return nil, apiErr
 	}
 	if len(values) == 0 {
-		return nil, MetaError(
-			400,
-			"refusing to create an entry without values",
-		)
+		return nil, MessageError(400, CodeEmptyRequest, nil)
+	}
+	if apiErr = c.authorize(r, POST, values); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkWritable(r, values); apiErr != nil {
+		return nil, apiErr
 	}
 
 	// TODO persist errors?
@@ -220,49 +400,50 @@ func (c *ResourceSQL) Post(r *Request) (Response, *APIError) {
 		return nil, apiErr
 	}
 
+	// Entries are always created within the scope
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	for name, value := range scope {
+		values[name] = value
+	}
+
 	// Check required fields
 	if apiErr = c.HasRequired(values); apiErr != nil {
 		return nil, apiErr
 	}
+	c.normalizeValues(values)
 
-	// TODO Check existence of foreign keys
-	// TODO Check unique fields - case insensitive if string?
+	if apiErr = c.validateObject(r.Tx, values); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if apiErr = runHooks(c.hooks.beforeCreate, r, values); apiErr != nil {
+		return nil, apiErr
+	}
 
 	// TODO only one pk for now
 	key := c.table.PrimaryKey()[0]
 
-	// Check for uniques using strict equality
-	uniques := c.table.UniqueConstraints()
-	for _, unique := range uniques {
-		// TODO Alternate forms of equality
-		columns := make([]sql.Selectable, len(unique))
-		clauses := make([]sql.Clause, len(unique))
-		for i, name := range unique {
-			columns[i] = c.table.C[name]
-			clauses[i] = c.table.C[name].Equals(values[name])
-		}
-		stmt := sql.Select(columns...).Where(sql.AllOf(clauses...))
-
-		result := sql.Values{}
-		dbErr := c.conn.QueryOne(stmt, result)
-		if dbErr == nil {
-			return nil, MetaError(400, "duplicate entry for values %s", result)
-		} else if dbErr != sql.ErrNoResult {
-			panic(fmt.Sprintf(
-				"argo: could not select uniques in sql resource post (%s): %s",
-				stmt,
-				dbErr,
-			))
-		}
+	// Check uniques and the existence of foreign keys
+	if apiErr = c.checkUniques(r.Tx, values, values, nil, scope); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkForeignKeys(r, values, scope); apiErr != nil {
+		return nil, apiErr
 	}
 
 	stmt := postgres.Insert(c.inserts).Returning(c.table.C[key]).Values(values)
 	if stmtErr := stmt.Error(); stmtErr != nil {
-		return nil, MetaError(400, stmtErr.Error())
+		return nil, invalidRequest(stmtErr)
 	}
 
 	var pk interface{}
-	if dbErr := c.conn.QueryOne(stmt, &pk); dbErr != nil {
+	if dbErr := r.Tx.QueryOne(stmt, &pk); dbErr != nil {
+		if apiErr = constraintError(dbErr); apiErr != nil {
+			return nil, apiErr
+		}
 		panic(fmt.Sprintf(
 			"argo: could not insert in sql resource post (%s): %s",
 			stmt,
@@ -271,11 +452,11 @@ func (c *ResourceSQL) Post(r *Request) (Response, *APIError) {
 	}
 
 	// Send the created resource back
-	selectStmt := sql.Select(c.selects).Where(c.table.C[key].Equals(pk))
+	selectStmt := sql.Select(c.readable(r)).Where(c.table.C[key].Equals(pk))
 
 	// If we get ErrNoResult then something is fucked
 	result := sql.Values{}
-	if dbErr := c.conn.QueryOne(selectStmt, result); dbErr != nil {
+	if dbErr := r.Tx.QueryOne(selectStmt, result); dbErr != nil {
 		panic(fmt.Sprintf(
 			"argo: could not query one in sql resource post (%s): %s",
 			selectStmt,
@@ -283,10 +464,23 @@ func (c *ResourceSQL) Post(r *Request) (Response, *APIError) {
 		))
 	}
 	FixValues(result)
+	c.includeDetail(r, r.Tx, result)
+	setETag(r, c.etag(result))
+
+	if apiErr = runHooks(c.hooks.afterCreate, r, result); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = runHooks(c.hooks.afterRead, r, result); apiErr != nil {
+		return nil, apiErr
+	}
 	return result, nil
 }
 
 func (c *ResourceSQL) Get(r *Request) (Response, *APIError) {
+	if apiErr := c.authorize(r, GET, nil); apiErr != nil {
+		return nil, apiErr
+	}
+
 	// Get the primary keys
 	// TODO Just one for now - but composites soon!
 	key := c.table.PrimaryKey()[0]
@@ -295,16 +489,31 @@ func (c *ResourceSQL) Get(r *Request) (Response, *APIError) {
 	// Validate the primary key value TODO multiple pk values
 	cleanPK, err := c.table.C[key].Type().Validate(dirtyPK)
 	if err != nil {
-		apiErr := NewError(400)
-		apiErr.SetField(key, err.Error())
+		apiErr := NewError(400).SetErrorCode(CodeInvalidKey)
+		apiErr.AddField(key, typeErrors(c.table.C[key].Type(), dirtyPK, err)...)
 		return nil, apiErr
 	}
 
-	stmt := sql.Select(c.selects).Where(c.table.C[key].Equals(cleanPK))
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	clauses := append(
+		[]sql.Clause{c.table.C[key].Equals(cleanPK)},
+		scopeClauses(c.table, scope)...,
+	)
+	if c.softDelete != nil && !c.includeDeleted(r) {
+		clauses = append(clauses, c.softDelete.visible())
+	}
+	stmt := sql.Select(c.readable(r)).Where(sql.AllOf(clauses...))
 	result := sql.Values{}
 	dbErr := c.conn.QueryOne(stmt, result)
 	if dbErr == sql.ErrNoResult {
-		return nil, MetaError(404, "no resource with %s %s", key, dirtyPK)
+		return nil, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": key, "value": dirtyPK},
+		)
 	} else if dbErr != nil {
 		panic(fmt.Sprintf(
 			"argo: could not query one in sql resource get (%s): %s",
@@ -314,20 +523,44 @@ func (c *ResourceSQL) Get(r *Request) (Response, *APIError) {
 	}
 
 	FixValues(result)
+	c.includeDetail(r, c.conn, result)
 
-	// Add the includes
-	for _, include := range c.detailIncludes {
-		if dbErr := include.Query(c.conn, result); dbErr != nil {
-			panic(fmt.Sprintf(
-				"argo: could not query includes in sql resource get (%s): %s",
-				dbErr,
-			))
-		}
+	// Tag the representation before any hooks modify it, and respond
+	// before encoding if the client's copy is current
+	if c.setCacheHeaders(r, c.etag(result), c.modified(result)) {
+		return NotModified{}, nil
+	}
+
+	if apiErr = runHooks(c.hooks.afterRead, r, result); apiErr != nil {
+		return nil, apiErr
 	}
 	return result, nil
 }
 
+// Patch updates the given fields of the entry with the requested primary
+// key. All queries are performed in a single transaction.
 func (c *ResourceSQL) Patch(r *Request) (Response, *APIError) {
+	return c.atomic(r, c.patch)
+}
+
+// Put replaces the writable fields of the entry with the requested primary
+// key. All required fields must be given, except create-only fields, which
+// keep their existing values. All queries are performed in a single
+// transaction.
+func (c *ResourceSQL) Put(r *Request) (Response, *APIError) {
+	return c.atomic(r, c.put)
+}
+
+func (c *ResourceSQL) patch(r *Request) (Response, *APIError) {
+	return c.update(r, false)
+}
+
+func (c *ResourceSQL) put(r *Request) (Response, *APIError) {
+	return c.update(r, true)
+}
+
+// update performs both PATCH and PUT requests
+func (c *ResourceSQL) update(r *Request, replace bool) (Response, *APIError) {
 	// Get the primary keys
 	// TODO Just one for now - but composites soon!
 	key := c.table.PrimaryKey()[0]
@@ -336,33 +569,93 @@ func (c *ResourceSQL) Patch(r *Request) (Response, *APIError) {
 	// Validate the primary key value TODO multiple pk values
 	cleanPK, err := c.table.C[key].Type().Validate(dirtyPK)
 	if err != nil {
-		apiErr := NewError(400)
-		apiErr.SetField(key, err.Error())
+		apiErr := NewError(400).SetErrorCode(CodeInvalidKey)
+		apiErr.AddField(key, typeErrors(c.table.C[key].Type(), dirtyPK, err)...)
 		return nil, apiErr
 	}
 
-	// Validate all fields
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Authorize before the entry is read, so that requests which are not
+	// allowed cannot learn whether it exists or its entity tag
 	values, apiErr := r.Decode(r.Body)
 	if apiErr != nil {
 		return nil, apiErr
 	}
-	if apiErr := c.Validate(values); apiErr != nil {
+	m := PATCH
+	if replace {
+		m = PUT
+	}
+	if apiErr = c.authorize(r, m, values); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkWritable(r, values); apiErr != nil {
 		return nil, apiErr
 	}
 
-	// Check unique fields - case insensitive if string?
-	stmt := c.table.Update().Values(values).Where(
-		c.table.C[key].Equals(cleanPK),
-	)
+	// Get the existing entry for preconditions and the update hooks
+	old, apiErr := c.current(r.Tx, key, cleanPK, dirtyPK, scope)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkIfMatch(r, old); apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Validate all fields
+	if apiErr = c.ValidateUpdate(values); apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Entries cannot be moved out of the scope
+	for name, value := range scope {
+		values[name] = value
+	}
+	c.normalizeValues(values)
+	if replace {
+		// Create-only fields keep their existing values
+		existing := sql.Values{}
+		for name := range c.createOnly {
+			existing[name] = old[name]
+		}
+		if apiErr = c.HasRequired(merge(existing, values)); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+
+	if apiErr = c.validateObject(r.Tx, merge(old, values)); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if apiErr = runUpdateHooks(c.hooks.beforeUpdate, r, old, values); apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Check uniques, excluding this entry, and the existence of foreign keys
+	// Hooks may have modified the values, so merge them again
+	if apiErr = c.checkUniques(r.Tx, merge(old, values), values, cleanPK, scope); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkForeignKeys(r, values, scope); apiErr != nil {
+		return nil, apiErr
+	}
+
+	stmt := c.table.Update().Values(values).Where(c.itemClause(cleanPK, scope))
 	if stmtErr := stmt.Error(); stmtErr != nil {
-		return nil, MetaError(400, stmtErr.Error())
+		return nil, invalidRequest(stmtErr)
 	}
 
 	// Perform the UPDATE
-	changes, err := c.conn.Execute(stmt)
+	changes, err := r.Tx.Execute(stmt)
 	if err != nil {
+		if apiErr = constraintError(err); apiErr != nil {
+			return nil, apiErr
+		}
 		panic(fmt.Sprintf(
-			"argo: could not execute sql resource patch (%s): %s",
+			"argo: could not execute sql resource update (%s): %s",
 			stmt,
 			err,
 		))
@@ -372,34 +665,55 @@ func (c *ResourceSQL) Patch(r *Request) (Response, *APIError) {
 	rows, err := changes.RowsAffected()
 	if err != nil {
 		panic(fmt.Sprintf(
-			"argo: unsupported RowsAffected in sql resource patch %s",
+			"argo: unsupported RowsAffected in sql resource update %s",
 			err,
 		))
 	}
 	if rows == 0 {
-		return nil, MetaError(404, "No resource with %s %s", key, dirtyPK)
+		return nil, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": key, "value": dirtyPK},
+		)
 	}
 
 	// Send the created resource back
-	selectStmt := sql.Select(c.selects).Where(c.table.C[key].Equals(cleanPK))
+	selectStmt := sql.Select(c.readable(r)).Where(c.table.C[key].Equals(cleanPK))
 
 	// If we get ErrNoResult then something is fucked
 	result := sql.Values{}
-	if dbErr := c.conn.QueryOne(selectStmt, result); dbErr != nil {
+	if dbErr := r.Tx.QueryOne(selectStmt, result); dbErr != nil {
 		panic(fmt.Sprintf(
-			"argo: could not query one in sql resource patch (%s): %s",
+			"argo: could not query one in sql resource update (%s): %s",
 			selectStmt,
 			dbErr,
 		))
 	}
 
-	// TODO includes?
-
 	FixValues(result)
+	c.includeDetail(r, r.Tx, result)
+	setETag(r, c.etag(result))
+
+	if apiErr = runUpdateHooks(c.hooks.afterUpdate, r, old, result); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = runHooks(c.hooks.afterRead, r, result); apiErr != nil {
+		return nil, apiErr
+	}
 	return result, nil
 }
 
+// Delete removes the entry with the requested primary key. The delete is
+// performed in a transaction.
 func (c *ResourceSQL) Delete(r *Request) (Response, *APIError) {
+	return c.atomic(r, c.delete)
+}
+
+func (c *ResourceSQL) delete(r *Request) (Response, *APIError) {
+	if apiErr := c.authorize(r, DELETE, nil); apiErr != nil {
+		return nil, apiErr
+	}
+
 	// Get the primary keys
 	// TODO Just one for now - but composites soon!
 	key := c.table.PrimaryKey()[0]
@@ -408,14 +722,41 @@ func (c *ResourceSQL) Delete(r *Request) (Response, *APIError) {
 	// Validate the primary key value TODO multiple pk values
 	cleanPK, err := c.table.C[key].Type().Validate(dirtyPK)
 	if err != nil {
-		apiErr := NewError(400)
-		apiErr.SetField(key, err.Error())
+		apiErr := NewError(400).SetErrorCode(CodeInvalidKey)
+		apiErr.AddField(key, typeErrors(c.table.C[key].Type(), dirtyPK, err)...)
 		return nil, apiErr
 	}
 
-	stmt := c.table.Delete().Where(c.table.C[key].Equals(cleanPK))
-	result, err := c.conn.Execute(stmt)
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Get the existing entry for preconditions and the delete hooks
+	old, apiErr := c.current(r.Tx, key, cleanPK, dirtyPK, scope)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = c.checkIfMatch(r, old); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = runHooks(c.hooks.beforeDelete, r, old); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var stmt sql.Executable
+	if c.softDelete != nil {
+		stmt = c.table.Update().Values(sql.Values{
+			c.softDelete.column.Name(): c.softDelete.mark(),
+		}).Where(c.itemClause(cleanPK, scope))
+	} else {
+		stmt = c.table.Delete().Where(c.itemClause(cleanPK, scope))
+	}
+	result, err := r.Tx.Execute(stmt)
 	if err != nil {
+		if apiErr = constraintError(err); apiErr != nil {
+			return nil, apiErr
+		}
 		panic(fmt.Sprintf(
 			"argo: could not execute sql resource delete (%s): %s",
 			stmt,
@@ -432,11 +773,133 @@ func (c *ResourceSQL) Delete(r *Request) (Response, *APIError) {
 		))
 	}
 	if rows == 0 {
-		return nil, MetaError(404, "No resource with %s %s", key, dirtyPK)
+		return nil, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": key, "value": dirtyPK},
+		)
+	}
+
+	if apiErr = runHooks(c.hooks.afterDelete, r, old); apiErr != nil {
+		return nil, apiErr
 	}
 	return nil, nil
 }
 
+// includeDetail adds the detail includes to the given entry
+func (c *ResourceSQL) includeDetail(r *Request, conn sql.Connection, result sql.Values) {
+	for _, include := range c.detailIncludes {
+		if dbErr := queryInclude(include, r, conn, result); dbErr != nil {
+			panic(fmt.Sprintf(
+				"argo: could not query includes in sql resource: %s",
+				dbErr,
+			))
+		}
+	}
+}
+
+// itemClause matches the entry with the given primary key within the
+// given scope, unless it has been soft deleted.
+func (c *ResourceSQL) itemClause(pk interface{}, scope sql.Values) sql.Clause {
+	// TODO only one pk for now
+	clauses := append(
+		[]sql.Clause{c.table.C[c.table.PrimaryKey()[0]].Equals(pk)},
+		scopeClauses(c.table, scope)...,
+	)
+	if c.softDelete != nil {
+		clauses = append(clauses, c.softDelete.visible())
+	}
+	return sql.AllOf(clauses...)
+}
+
+// current selects every column of the entry with the given primary key,
+// including those that are excluded from the selects. Entries that are
+// soft deleted or outside the scope are not found.
+func (c *ResourceSQL) current(conn sql.Connection, key string, pk interface{}, dirtyPK string, scope sql.Values) (sql.Values, *APIError) {
+	result := c.entry(conn, c.itemClause(pk, scope))
+	if result == nil {
+		return nil, MessageError(
+			404,
+			CodeNotFound,
+			map[string]interface{}{"key": key, "value": dirtyPK},
+		)
+	}
+	return result, nil
+}
+
+// entry selects every column of the entry matching the clause, or returns
+// nil if there is none
+func (c *ResourceSQL) entry(conn sql.Connection, clause sql.Clause) sql.Values {
+	stmt := sql.Select(ColumnSet(c.table.Columns()...)).Where(clause)
+
+	result := sql.Values{}
+	dbErr := conn.QueryOne(stmt, result)
+	if dbErr == sql.ErrNoResult {
+		return nil
+	} else if dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not query current entry in sql resource (%s): %s",
+			stmt,
+			dbErr,
+		))
+	}
+	FixValues(result)
+	return result
+}
+
+// atomic runs the given handler inside a transaction that is set on the
+// request. The transaction is committed only if the handler returns without
+// an error; errors and panics roll it back. If the request already has a
+// transaction, or the resource's connection is itself a transaction, the
+// handler joins it and its owner is left to commit or roll back.
+func (c *ResourceSQL) atomic(r *Request, handler func(*Request) (Response, *APIError)) (response Response, apiErr *APIError) {
+	if r.Tx != nil {
+		return handler(r)
+	}
+	if tx, ok := c.conn.(sql.Transaction); ok {
+		// Later queries of the connection will see the writes
+		r.Tx = tx
+		defer func() { r.Tx = nil }()
+		if response, apiErr = handler(r); apiErr == nil {
+			r.committed()
+		}
+		return
+	}
+
+	tx, err := c.conn.Begin()
+	if err != nil {
+		panic(fmt.Sprintf(
+			"argo: could not begin transaction in sql resource %s: %s",
+			c.Name,
+			err,
+		))
+	}
+	r.Tx = tx
+
+	defer func() {
+		r.Tx = nil
+		if p := recover(); p != nil {
+			r.commits = nil
+			tx.Rollback()
+			panic(p)
+		}
+		if apiErr != nil {
+			r.commits = nil
+			tx.Rollback()
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			panic(fmt.Sprintf(
+				"argo: could not commit transaction in sql resource %s: %s",
+				c.Name,
+				err,
+			))
+		}
+		r.committed()
+	}()
+	return handler(r)
+}
+
 func InvalidName(name string) error {
 	if name == "" {
 		return fmt.Errorf("argo: invalid resource name '%s'", name)
@@ -460,6 +923,13 @@ func Resource(t TableElem, fields ...Modifier) *ResourceSQL {
 		inserts: ColumnSet(t.table.Columns()...),
 		fields:  make(map[string]Validator),
 
+		readOnly:   Columns{},
+		createOnly: Columns{},
+
+		policies:      make(map[method][]Policy),
+		readPolicies:  make(map[string][]Policy),
+		writePolicies: make(map[string][]Policy),
+
 		// Default values - TODO how to set max?
 		limit:   10000,
 		filters: make(map[string]Filter),
@@ -489,6 +959,11 @@ func Resource(t TableElem, fields ...Modifier) *ResourceSQL {
 		resource.order = append(resource.order, t.table.C[pk].Asc())
 	}
 
+	// Check the unique constraints of the table using strict equality
+	for _, unique := range t.table.UniqueConstraints() {
+		resource.uniques = append(resource.uniques, Unique(unique...))
+	}
+
 	// TODO Make sure the table has no keywords, e.g. order, limit, offset
 
 	for _, field := range fields {
@@ -76,29 +76,29 @@ func TestParseOrder(t *testing.T) {
 
 	assert.Equal(
 		[]sql.Orderable(nil),
-		users.parseOrder(""),
+		users.parseOrder("", users.selects),
 	)
 	assert.Equal(
 		[]sql.Orderable{usersDB.C["id"].Asc()},
-		users.parseOrder("id"),
+		users.parseOrder("id", users.selects),
 	)
 	assert.Equal(
 		[]sql.Orderable{usersDB.C["id"].Desc()},
-		users.parseOrder("-id"),
+		users.parseOrder("-id", users.selects),
 	)
 	assert.Equal(
 		[]sql.Orderable{usersDB.C["name"].Asc(), usersDB.C["id"].Desc()},
-		users.parseOrder("name,-id"),
+		users.parseOrder("name,-id", users.selects),
 	)
 
 	// Malformed input
 	assert.Equal(
 		[]sql.Orderable(nil),
-		users.parseOrder(",,,,"),
+		users.parseOrder(",,,,", users.selects),
 	)
 	assert.Equal(
 		[]sql.Orderable(nil),
-		users.parseOrder(",,what,,"),
+		users.parseOrder(",,what,,", users.selects),
 	)
 }
 
@@ -149,7 +149,12 @@ func TestSimpleResourceSQL(t *testing.T) {
 	defer conn.Close()
 
 	// Resources must be created with a connection
-	users := Resource(FromTable(usersDB))
+	users := Resource(
+		FromTable(usersDB),
+		WriteOnly("password"),
+		ReadOnly("created"),
+		CreateOnly("age"),
+	)
 	users.conn = tx
 
 	// Since *APIErr implements error, explicitly request an API error
@@ -179,9 +184,12 @@ func TestSimpleResourceSQL(t *testing.T) {
 	assert.Equal(admin.Name, result["name"])
 	assert.Equal(admin.Age, result["age"])
 	assert.Equal(admin.IsActive, result["is_active"])
-	assert.Equal(admin.Password, result["password"])
 	assert.Equal(true, result["created"].(time.Time).Before(time.Now()))
 
+	// Write-only fields are never returned
+	_, exists := result["password"]
+	assert.Equal(false, exists)
+
 	// GET - valid
 	uid := result["id"].(int64)
 	response, errAPI = users.Get(MockRequest(nil, nil, uid))
@@ -226,7 +234,20 @@ func TestSimpleResourceSQL(t *testing.T) {
 	assert.Equal(400, errAPI.code)
 	assert.NotNil(errAPI.Fields["extra"])
 
-	// TODO PATCH - duplicates
+	// PATCH - duplicates
+	b, err = json.Marshal(user{Name: "client", Age: 1, Password: "secret"})
+	require.Nil(t, err)
+	_, errAPI = users.Post(MockRequest(b, nil))
+	require.Nil(t, errAPI)
+
+	_, errAPI = users.Patch(MockRequest([]byte(`{"name":"client"}`), nil, uid))
+	assert.Equal(true, errAPI.Exists())
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["name"])
+
+	// PATCH - the entry's own values are not duplicates
+	_, errAPI = users.Patch(MockRequest([]byte(`{"name":"admin"}`), nil, uid))
+	assert.Nil(errAPI)
 
 	// PATCH - id
 	_, errAPI = users.Patch(MockRequest([]byte(`{"id":"3"}`), nil, uid))
@@ -234,8 +255,20 @@ func TestSimpleResourceSQL(t *testing.T) {
 	assert.Equal(400, errAPI.code)
 	assert.NotNil(errAPI.Fields["id"])
 
+	// PATCH - read-only field
+	_, errAPI = users.Patch(MockRequest([]byte(`{"created":"2015-01-01T00:00:00Z"}`), nil, uid))
+	assert.Equal(true, errAPI.Exists())
+	assert.Equal(400, errAPI.code)
+	assert.Equal("is read-only", errAPI.Field("created"))
+
+	// PATCH - create-only field
+	_, errAPI = users.Patch(MockRequest([]byte(`{"age":3}`), nil, uid))
+	assert.Equal(true, errAPI.Exists())
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["age"])
+
 	// PATCH - valid
-	response, errAPI = users.Patch(MockRequest([]byte(`{"name":"Q"}`), nil, uid))
+	response, errAPI = users.Patch(MockRequest([]byte(`{"name":"Q","password":"new"}`), nil, uid))
 	assert.Nil(errAPI)
 	result, ok = response.(sql.Values)
 	require.Equal(t, true, ok)
@@ -243,7 +276,8 @@ func TestSimpleResourceSQL(t *testing.T) {
 	assert.Equal("Q", result["name"])
 	assert.Equal(admin.Age, result["age"])
 	assert.Equal(admin.IsActive, result["is_active"])
-	assert.Equal(admin.Password, result["password"])
+	_, exists = result["password"]
+	assert.Equal(false, exists)
 
 	// DELETE - invalid id
 	response, errAPI = users.Delete(MockRequest(nil, nil, "whatever"))
@@ -309,14 +343,18 @@ func TestResource_Post(t *testing.T) {
 	b, err = json.Marshal(user{Name: "admin", Password: "secret"})
 	require.Nil(t, err)
 
-	_, errAPI = users.Post(MockRequest(b, nil))
+	request := MockRequest(b, nil)
+	_, errAPI = users.Post(request)
 	assert.Nil(errAPI)
 
+	// The transaction should be released once the request is complete
+	assert.Nil(request.Tx)
+
 	// POST a duplicate name
 	_, errAPI = users.Post(MockRequest(b, nil))
 	assert.Equal(true, errAPI.Exists())
 	assert.Equal(400, errAPI.code)
-	assert.Equal(1, len(errAPI.Meta))
+	assert.NotNil(errAPI.Fields["name"])
 
 	// Check uniqueness of composite constraints
 	b, err = json.Marshal(edge{A: 2, B: 3})
@@ -327,5 +365,146 @@ func TestResource_Post(t *testing.T) {
 	_, errAPI = edges.Post(MockRequest(b, nil))
 	assert.Equal(true, errAPI.Exists())
 	assert.Equal(400, errAPI.code)
-	assert.Equal(1, len(errAPI.Meta))
+	assert.NotNil(errAPI.Fields["a"])
+	assert.NotNil(errAPI.Fields["b"])
+}
+
+func TestResource_AfterCreateRollback(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t)
+	tx.Rollback()
+	defer conn.Close()
+
+	// The resource must begin its own transaction, so the table is created
+	// outside of a test transaction
+	_, err := conn.Execute(usersDB.Create())
+	require.Nil(t, err)
+	defer conn.Execute(usersDB.Drop())
+
+	users := Resource(
+		FromTable(usersDB),
+		AfterCreate(func(r *Request, values sql.Values) *APIError {
+			return MetaError(500, "could not notify")
+		}),
+	)
+	users.conn = conn
+
+	_, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"secret"}`), nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.Equal(500, errAPI.code)
+
+	// The entry was inserted before the hook, and has been rolled back
+	response, errAPI := users.List(MockRequest(nil, nil))
+	require.Nil(t, errAPI)
+	assert.Equal(0, len(response.(MultiResponse).Results.([]sql.Values)))
+}
+
+func TestResource_Put(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(FromTable(usersDB), ReadOnly("created"))
+	users.conn = tx
+
+	response, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"secret"}`), nil,
+	))
+	require.Nil(t, errAPI)
+	uid := response.(sql.Values)["id"].(int64)
+
+	// PUT requires every required field
+	_, errAPI = users.Put(MockRequest([]byte(`{"name":"Q"}`), nil, uid))
+	assert.Equal(true, errAPI.Exists())
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["age"])
+	assert.NotNil(errAPI.Fields["password"])
+
+	response, errAPI = users.Put(MockRequest(
+		[]byte(`{"name":"Q","age":2,"password":"secret"}`), nil, uid,
+	))
+	require.Nil(t, errAPI)
+	assert.Equal("Q", response.(sql.Values)["name"])
+	assert.Equal(int64(2), response.(sql.Values)["age"])
+}
+
+func TestResource_ForeignKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	// companyDB lives in many_to_many_test.go and contactsDB in many_test.go
+	conn, tx := initSchemas(t, companyDB, contactsDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	contacts := Resource(FromTable(contactsDB))
+	contacts.conn = tx
+
+	b, err := json.Marshal(contact{CompanyID: 1, Key: "a", Value: "b"})
+	require.Nil(t, err)
+	_, errAPI := contacts.Post(MockRequest(b, nil))
+	assert.Equal(true, errAPI.Exists())
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["company_id"])
+
+	// Rows outside the scope of the target resource cannot be referenced
+	companies := Resource(FromTable(companyDB))
+	companies.conn = tx
+	response, errAPI := companies.Post(MockRequest([]byte(`{"name":"A"}`), nil))
+	require.Nil(t, errAPI)
+	cid := response.(sql.Values)["id"].(int64)
+
+	hidden := Resource(FromTable(companyDB), Scope(func(r *Request) (sql.Values, *APIError) {
+		return sql.Values{"id": cid + 1}, nil
+	}))
+	scoped := Resource(FromTable(contactsDB), References("company_id", hidden))
+	scoped.conn = tx
+
+	b, err = json.Marshal(contact{CompanyID: cid, Key: "a", Value: "b"})
+	require.Nil(t, err)
+	_, errAPI = scoped.Post(MockRequest(b, nil))
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["company_id"])
+
+	_, errAPI = contacts.Post(MockRequest(b, nil))
+	assert.Nil(errAPI)
+}
+
+func TestResource_ValidateWith(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(
+		FromTable(usersDB),
+		ValidateWith("name", Length(3, 0), Regex(`^[a-z]+$`)),
+		ValidateWith("password", Length(8, 0)),
+		Required("is_active"),
+	)
+	users.conn = tx
+
+	// Every invalid field is reported
+	_, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":"Q","password":"short"}`), nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+	assert.NotNil(errAPI.Fields["name"])
+	assert.NotNil(errAPI.Fields["password"])
+
+	// Fields with defaults can be made required
+	_, errAPI = users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"password":"long enough"}`), nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.NotNil(errAPI.Fields["is_active"])
+
+	_, errAPI = users.Post(MockRequest(
+		[]byte(`{"name":"admin","age":1,"is_active":true,"password":"long enough"}`), nil,
+	))
+	assert.Nil(errAPI)
 }
@@ -10,10 +10,16 @@ type Meta struct {
 	Limit   int             `json:"limit"`
 	Offset  int             `json:"offset"`
 	order   []sql.Orderable `json:"-"`
+	sort    []sortKey       `json:"-"` // The parsed order, if any
 	filters []sql.Clause    `json:"-"`
 }
 
 type MultiResponse struct {
 	Meta    Meta        `json:"meta"`
 	Results interface{} `json:"results"`
+	fields  []string    // Column order of the results, if known
 }
+
+// NotModified is the response to a conditional GET whose representation
+// has not changed. It is written as a 304 without a body.
+type NotModified struct{}
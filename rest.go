@@ -11,6 +11,11 @@ type Rest interface {
 	Delete(*Request) (Response, *APIError)
 }
 
+// Putter is implemented by resources that support replacing items with PUT
+type Putter interface {
+	Put(*Request) (Response, *APIError)
+}
+
 // Handle is an alias for Rest
 type Handle interface {
 	Rest
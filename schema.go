@@ -0,0 +1,150 @@
+package argo
+
+import (
+	sql "github.com/aodin/aspect"
+)
+
+// JSONSchemaDialect is the JSON Schema version of resource schemas
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchemer is implemented by resources that describe their payloads
+// with JSON Schema. The schema is served at the schema path of the
+// collection and in response to OPTIONS requests of the collection.
+//
+// Both require authentication like any other request: the schema leaves
+// out the fields that the principal may not write, and is only served to
+// requests that may read the resource. CORS preflight requests, which
+// have no credentials, must be answered before they reach the API.
+type JSONSchemer interface {
+	JSONSchema(*Request) (Response, *APIError)
+}
+
+// ResourceSchema is the JSON Schema of the payloads of a resource. Create
+// and update payloads differ in their required and create-only fields.
+type ResourceSchema struct {
+	Create Schema `json:"create"`
+	Update Schema `json:"update"`
+}
+
+// columnDefault returns the default value of a column type. Only
+// defaults that are JSON values are known; others, such as SQL
+// expressions, only make the field optional.
+func columnDefault(t sql.Type) (interface{}, bool) {
+	if col, ok := t.(sql.Boolean); ok && col.Default != nil {
+		return bool(*col.Default), true
+	}
+	return nil, false
+}
+
+// validatorKeywords adds the keywords of the built-in validators to the
+// schema. Other validators can only be checked by the API.
+func validatorKeywords(validator Validator, schema Schema) {
+	switch v := validator.(type) {
+	case Validators:
+		for _, each := range v {
+			validatorKeywords(each, schema)
+		}
+	case regexValidator:
+		schema["pattern"] = v.pattern.String()
+	case lengthValidator:
+		if v.min > 0 {
+			schema["minLength"] = v.min
+		}
+		if max, exists := schema["maxLength"].(int); v.max > 0 && (!exists || v.max < max) {
+			schema["maxLength"] = v.max
+		}
+	case rangeValidator:
+		schema["minimum"] = v.min
+		schema["maximum"] = v.max
+	case enumValidator:
+		schema["enum"] = v.choices
+	case emailValidator:
+		schema["format"] = "email"
+	case urlValidator:
+		schema["format"] = "uri"
+	}
+}
+
+// fieldSchema returns the schema of a writable field, including the
+// keywords of its validators
+func (c *ResourceSQL) fieldSchema(column sql.ColumnElem) Schema {
+	schema := columnSchema(column)
+	if value, exists := columnDefault(column.Type()); exists {
+		schema["default"] = value
+	}
+	if validator, exists := c.fields[column.Name()]; exists {
+		validatorKeywords(validator, schema)
+	}
+	return schema
+}
+
+// jsonSchema converts an input schema of the OpenAPI document to JSON
+// Schema, where nullable fields accept the null type. Fields that the
+// request may not write are removed.
+func (c *ResourceSQL) jsonSchema(r *Request, input Schema, title string) Schema {
+	properties := input["properties"].(Schema)
+	writable := Schema{}
+	for name, property := range properties {
+		if !allowed(c.writePolicies[name], r, nil) {
+			continue
+		}
+		field := Schema{}
+		for keyword, value := range property.(Schema) {
+			field[keyword] = value
+		}
+		if field["nullable"] == true {
+			delete(field, "nullable")
+			if typ, exists := field["type"]; exists {
+				field["type"] = []interface{}{typ, "null"}
+			}
+			if choices, exists := field["enum"].([]interface{}); exists {
+				field["enum"] = append(append([]interface{}{}, choices...), nil)
+			}
+		}
+		writable[name] = field
+	}
+
+	schema := Schema{
+		"$schema":              JSONSchemaDialect,
+		"title":                title,
+		"type":                 "object",
+		"properties":           writable,
+		"additionalProperties": false,
+	}
+	if required, exists := input["required"].([]string); exists {
+		fields := make([]string, 0, len(required))
+		for _, name := range required {
+			if writable[name] != nil {
+				fields = append(fields, name)
+			}
+		}
+		schema["required"] = fields
+	}
+
+	// Uniqueness can only be checked by the API, so it is an annotation
+	uniques := make([][]string, 0)
+	for _, unique := range c.uniques {
+		for _, name := range unique.columns {
+			if writable[name] != nil {
+				uniques = append(uniques, unique.columns)
+				break
+			}
+		}
+	}
+	if len(uniques) > 0 {
+		schema["x-unique"] = uniques
+	}
+	return schema
+}
+
+// JSONSchema implements the JSONSchemer interface. Requests that may read
+// the resource may read its schema.
+func (c *ResourceSQL) JSONSchema(r *Request) (Response, *APIError) {
+	if apiErr := c.authorize(r, GET, nil); apiErr != nil {
+		return nil, apiErr
+	}
+	return ResourceSchema{
+		Create: c.jsonSchema(r, c.inputSchema(false), c.Name+" create"),
+		Update: c.jsonSchema(r, c.inputSchema(true), c.Name+" update"),
+	}, nil
+}
@@ -0,0 +1,139 @@
+package argo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceSQL_JSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	users := Resource(
+		FromTable(usersDB),
+		CreateOnly("name"),
+		ValidateWith("name", Length(2, 0), Regex(`^[a-z]+$`)),
+		ValidateWith("age", Range(0, 150)),
+		ValidateWith("password", Length(8, 64)),
+	)
+	response, apiErr := users.JSONSchema(MockRequest(nil, nil))
+	require.Nil(t, apiErr)
+	schema := response.(ResourceSchema)
+
+	create := schema.Create
+	assert.Equal(JSONSchemaDialect, create["$schema"])
+	assert.Equal([]string{"name", "age", "password"}, create["required"])
+	assert.Equal(false, create["additionalProperties"])
+	assert.Equal([][]string{{"name"}}, create["x-unique"])
+
+	properties := create["properties"].(Schema)
+	assert.NotContains(properties, "id")
+	assert.Equal(Schema{
+		"type":      "string",
+		"minLength": 2,
+		"pattern":   `^[a-z]+$`,
+	}, properties["name"])
+	assert.Equal(Schema{
+		"type":    "integer",
+		"format":  "int64",
+		"minimum": float64(0),
+		"maximum": float64(150),
+	}, properties["age"])
+	assert.Equal(Schema{
+		"type":    []interface{}{"boolean", "null"},
+		"default": true,
+	}, properties["is_active"])
+	assert.Equal(8, properties["password"].(Schema)["minLength"])
+	assert.Equal(64, properties["password"].(Schema)["maxLength"])
+
+	// Create-only fields cannot be updated, and no field is required
+	update := schema.Update
+	assert.NotContains(update["properties"], "name")
+	assert.NotContains(update, "required")
+	assert.NotContains(update, "x-unique")
+
+	// Nullable choices accept null
+	tags := Resource(
+		FromTable(usersDB).Exclude("created"),
+		ValidateWith("created", Enum("a", "b")),
+	)
+	response, _ = tags.JSONSchema(MockRequest(nil, nil))
+	assert.Equal(
+		[]interface{}{"a", "b", nil},
+		response.(ResourceSchema).Create["properties"].(Schema)["created"].(Schema)["enum"],
+	)
+}
+
+func TestAPI_JSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	api := New()
+	require.Nil(t, api.Add(Resource(FromTable(usersDB))))
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/users/schema")
+	require.Nil(t, err)
+	var schema struct {
+		Create map[string]interface{} `json:"create"`
+		Update map[string]interface{} `json:"update"`
+	}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&schema))
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("users create", schema.Create["title"])
+	assert.Equal("users update", schema.Update["title"])
+
+	// The schema is also the response to OPTIONS requests
+	request, _ := http.NewRequest("OPTIONS", ts.URL+"/users", nil)
+	resp, err = http.DefaultClient.Do(request)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestGuarded_JSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := APIKeys{
+		"admin": &Principal{ID: "1", Roles: []string{"admin"}},
+		"user":  &Principal{ID: "2"},
+	}
+	api := New().Authenticate(APIKey(keys))
+	require.Nil(t, api.AddRest(
+		"users",
+		Guard(Resource(FromTable(usersDB))).Allow(GET, AllowRoles("admin")),
+		"id",
+	))
+	require.Nil(t, api.AddRest("things", Guard(mockResource{}), "id"))
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	do := func(method, path, key string) int {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The schema is guarded by the GET policies
+	assert.Equal(http.StatusOK, do("GET", "/users/schema", "admin"))
+	assert.Equal(http.StatusOK, do("OPTIONS", "/users", "admin"))
+	assert.Equal(http.StatusForbidden, do("GET", "/users/schema", "user"))
+	assert.Equal(http.StatusForbidden, do("OPTIONS", "/users", "user"))
+
+	// Schemas require authentication, since they depend on the principal
+	assert.Equal(http.StatusUnauthorized, do("OPTIONS", "/users", ""))
+
+	// Resources without a schema have none when guarded
+	assert.Equal(http.StatusNotFound, do("GET", "/things/schema", "admin"))
+	assert.Equal(http.StatusBadRequest, do("OPTIONS", "/things", "admin"))
+}
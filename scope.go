@@ -0,0 +1,87 @@
+package argo
+
+import (
+	"fmt"
+
+	sql "github.com/aodin/aspect"
+)
+
+// ScopeFunc returns the column values that restrict a resource to the rows
+// visible to the request, such as the organization of the caller. Returning
+// an error aborts the request.
+type ScopeFunc func(*Request) (sql.Values, *APIError)
+
+// Scope returns a Modifier that restricts every request of the resource to
+// the rows matching the values returned by the given function. List, Get,
+// Patch, Put and Delete only find rows within the scope; rows outside it
+// are reported as not found. Writes always set the scope values, and
+// uniqueness is checked within the scope. Includes whose tables have any
+// of the scope columns are scoped as well.
+func Scope(fn ScopeFunc) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		if resource.scope != nil {
+			return fmt.Errorf(
+				"argo: the resource %s already has a scope",
+				resource.Name,
+			)
+		}
+		resource.scope = fn
+		return nil
+	})
+}
+
+// scoped returns the scope values of the request, which are empty if the
+// resource has no scope. The values are kept on the request by resource,
+// so that the includes of the resource are scoped as well, and so that
+// other resources that share the request, such as in custom actions, are
+// scoped by their own function.
+func (c *ResourceSQL) scoped(r *Request) (sql.Values, *APIError) {
+	if c.scope == nil {
+		return sql.Values{}, nil
+	}
+	if values, exists := r.scopes[c]; exists {
+		return values, nil
+	}
+	values, apiErr := c.scope(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	for name := range values {
+		if _, exists := c.table.C[name]; !exists {
+			panic(fmt.Sprintf(
+				"argo: cannot scope by '%s', table '%s' does not have a column with this name",
+				name,
+				c.table.Name,
+			))
+		}
+	}
+	if values == nil {
+		values = sql.Values{}
+	}
+	if r.scopes == nil {
+		r.scopes = make(map[*ResourceSQL]sql.Values)
+	}
+	r.scopes[c] = values
+	return values, nil
+}
+
+// scopeOf returns the scope values that the resource has found for the
+// request, if any. Includes queried without a request are not scoped.
+func scopeOf(r *Request, c *ResourceSQL) sql.Values {
+	if r == nil {
+		return nil
+	}
+	return r.scopes[c]
+}
+
+// scopeClauses returns clauses that match the scope values on the given
+// table. Scope columns that the table does not have are skipped.
+func scopeClauses(table *sql.TableElem, scope sql.Values) []sql.Clause {
+	clauses := make([]sql.Clause, 0, len(scope))
+	for name, value := range scope {
+		if column, exists := table.C[name]; exists {
+			clauses = append(clauses, column.Equals(value))
+		}
+	}
+	return clauses
+}
@@ -0,0 +1,133 @@
+package argo
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/aodin/aspect/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var documentsDB = sql.Table("documents",
+	sql.Column("id", postgres.Serial{}),
+	sql.Column("org_id", sql.Integer{NotNull: true}),
+	sql.Column("name", sql.String{NotNull: true}),
+	sql.PrimaryKey("id"),
+)
+
+// orgScope scopes requests by the organization in the X-Org header
+func orgScope(r *Request) (sql.Values, *APIError) {
+	org, err := strconv.ParseInt(r.Header.Get("X-Org"), 10, 64)
+	if err != nil {
+		return nil, MetaError(403, "an organization is required")
+	}
+	return sql.Values{"org_id": org}, nil
+}
+
+func orgRequest(org string, b []byte, ids ...interface{}) *Request {
+	r := MockRequest(b, nil, ids...)
+	r.Header = http.Header{"X-Org": []string{org}}
+	return r
+}
+
+func TestScope(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, documentsDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	documents := Resource(
+		FromTable(documentsDB),
+		Scope(orgScope),
+		Unique("name"),
+	)
+	documents.conn = tx
+
+	// Entries are created within the scope, whatever the body says
+	response, errAPI := documents.Post(
+		orgRequest("1", []byte(`{"name":"plan","org_id":2}`)),
+	)
+	require.Nil(t, errAPI)
+	assert.Equal(int64(1), response.(sql.Values)["org_id"])
+	id := response.(sql.Values)["id"].(int64)
+
+	// Uniqueness is checked within the scope
+	_, errAPI = documents.Post(orgRequest("1", []byte(`{"name":"plan"}`)))
+	require.NotNil(t, errAPI)
+	assert.NotNil(errAPI.Fields["name"])
+
+	_, errAPI = documents.Post(orgRequest("2", []byte(`{"name":"plan"}`)))
+	require.Nil(t, errAPI)
+
+	// Other scopes do not see the entry
+	response, errAPI = documents.List(orgRequest("2", nil))
+	require.Nil(t, errAPI)
+	assert.Equal(1, len(response.(MultiResponse).Results.([]sql.Values)))
+
+	_, errAPI = documents.Get(orgRequest("2", nil, id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+
+	_, errAPI = documents.Patch(orgRequest("2", []byte(`{"name":"x"}`), id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+
+	_, errAPI = documents.Delete(orgRequest("2", nil, id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+
+	// Entries cannot be moved out of their scope
+	response, errAPI = documents.Patch(
+		orgRequest("1", []byte(`{"org_id":2}`), id),
+	)
+	require.Nil(t, errAPI)
+	assert.Equal(int64(1), response.(sql.Values)["org_id"])
+
+	_, errAPI = documents.Delete(orgRequest("1", nil, id))
+	assert.Nil(errAPI)
+
+	// Scope errors abort the request
+	_, errAPI = documents.List(MockRequest(nil, nil))
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+}
+
+func TestScopeClauses(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0, len(scopeClauses(documentsDB, sql.Values{})))
+	assert.Equal(
+		1,
+		len(scopeClauses(documentsDB, sql.Values{"org_id": 1, "team_id": 2})),
+	)
+}
+
+func TestResourceSQL_Scoped(t *testing.T) {
+	assert := assert.New(t)
+
+	documents := Resource(FromTable(documentsDB), Scope(orgScope))
+	others := Resource(
+		FromTable(documentsDB),
+		Scope(func(r *Request) (sql.Values, *APIError) {
+			return sql.Values{"org_id": int64(2)}, nil
+		}),
+	)
+	unscoped := Resource(FromTable(documentsDB))
+
+	// Resources that share a request have scopes of their own
+	r := orgRequest("1", nil)
+	scope, errAPI := documents.scoped(r)
+	require.Nil(t, errAPI)
+	assert.Equal(sql.Values{"org_id": int64(1)}, scope)
+	scope, _ = others.scoped(r)
+	assert.Equal(sql.Values{"org_id": int64(2)}, scope)
+	scope, _ = unscoped.scoped(r)
+	assert.Equal(sql.Values{}, scope)
+	assert.Equal(sql.Values{"org_id": int64(1)}, scopeOf(r, documents))
+
+	// Includes queried without a request are not scoped
+	assert.Nil(scopeOf(nil, documents))
+}
@@ -0,0 +1,213 @@
+package argo
+
+import (
+	"fmt"
+	"time"
+
+	sql "github.com/aodin/aspect"
+)
+
+// softDelete hides rows that have been marked as deleted by a timestamp
+// column, such as deleted_at, or a boolean column, such as is_deleted.
+type softDelete struct {
+	column sql.ColumnElem
+	allow  func(*Request) bool // May the request include deleted rows?
+}
+
+func newSoftDelete(table *sql.TableElem, name string) (*softDelete, error) {
+	column, exists := table.C[name]
+	if !exists {
+		return nil, fmt.Errorf(
+			"argo: cannot soft delete using '%s', table '%s' does not have a column with this name",
+			name,
+			table.Name,
+		)
+	}
+	switch column.Type().(type) {
+	case sql.Timestamp, sql.Boolean:
+	default:
+		return nil, fmt.Errorf(
+			"argo: cannot soft delete using '%s', it is neither a timestamp nor a boolean column",
+			name,
+		)
+	}
+	return &softDelete{column: column}, nil
+}
+
+// visible returns a clause that matches rows that have not been deleted
+func (sd softDelete) visible() sql.Clause {
+	if _, ok := sd.column.Type().(sql.Boolean); ok {
+		return sd.column.Equals(false)
+	}
+	return sd.column.IsNull()
+}
+
+// deleted returns a clause that matches rows that have been deleted
+func (sd softDelete) deleted() sql.Clause {
+	if _, ok := sd.column.Type().(sql.Boolean); ok {
+		return sd.column.Equals(true)
+	}
+	return sd.column.IsNotNull()
+}
+
+// mark returns the column value of a deleted row
+func (sd softDelete) mark() interface{} {
+	if _, ok := sd.column.Type().(sql.Boolean); ok {
+		return true
+	}
+	return time.Now().UTC()
+}
+
+// unmark returns the column value of a restored row
+func (sd softDelete) unmark() interface{} {
+	if _, ok := sd.column.Type().(sql.Boolean); ok {
+		return false
+	}
+	return nil
+}
+
+// includeDeleted reports whether the request asked for deleted rows with
+// ?include_deleted=true and is allowed to see them
+func (sd softDelete) includeDeleted(r *Request) bool {
+	if r == nil || sd.allow == nil || r.Get("include_deleted") != "true" {
+		return false
+	}
+	return sd.allow(r)
+}
+
+// includeDeleted reports whether the request may include soft deleted
+// rows, both of the resource and of its includes
+func (c *ResourceSQL) includeDeleted(r *Request) bool {
+	return c.softDelete != nil && c.softDelete.includeDeleted(r)
+}
+
+// SoftDeleteElem is the internal representation of a soft delete mode.
+// Deletes will mark rows as deleted instead of removing them, and deleted
+// rows will be hidden from all other requests. Deleted rows can be
+// restored with POST to the item action 'restore' by requests that the
+// DELETE policies of the resource allow.
+type SoftDeleteElem struct {
+	name  string
+	allow func(*Request) bool
+}
+
+// AllowIncludeDeleted sets the function that decides if a request may
+// include deleted rows with the query parameter include_deleted=true.
+// By default, deleted rows are never included.
+func (elem SoftDeleteElem) AllowIncludeDeleted(allow func(*Request) bool) SoftDeleteElem {
+	elem.allow = allow
+	return elem
+}
+
+// Modify implements the Modifier interface. The soft delete column becomes
+// read-only.
+func (elem SoftDeleteElem) Modify(resource *ResourceSQL) error {
+	if resource.softDelete != nil {
+		return fmt.Errorf(
+			"argo: the resource %s already has a soft delete column",
+			resource.Name,
+		)
+	}
+	sd, err := newSoftDelete(resource.table, elem.name)
+	if err != nil {
+		return err
+	}
+	sd.allow = elem.allow
+	resource.softDelete = sd
+	if err = ReadOnly(elem.name).Modify(resource); err != nil {
+		return err
+	}
+	return Action{
+		Method:  string(POST),
+		Name:    "restore",
+		Item:    true,
+		Handler: resource.restore,
+	}.Modify(resource)
+}
+
+// SoftDelete creates a new soft delete mode using the given timestamp or
+// boolean column.
+func SoftDelete(name string) SoftDeleteElem {
+	return SoftDeleteElem{name: name}
+}
+
+// restore undeletes the soft deleted entry with the requested primary key.
+// Restores are authorized by the DELETE policies of the resource, and are
+// otherwise updates: they check the If-Match header and run the update
+// hooks, which are given the change to the soft delete column.
+func (c *ResourceSQL) restore(r *Request) (Response, *APIError) {
+	if apiErr := c.authorize(r, DELETE, nil); apiErr != nil {
+		return nil, apiErr
+	}
+
+	key := c.table.PrimaryKey()[0]
+	dirtyPK := r.Params.ByName(key)
+
+	cleanPK, err := c.table.C[key].Type().Validate(dirtyPK)
+	if err != nil {
+		apiErr := NewError(400).SetErrorCode(CodeInvalidKey)
+		apiErr.AddField(key, typeErrors(c.table.C[key].Type(), dirtyPK, err)...)
+		return nil, apiErr
+	}
+
+	scope, apiErr := c.scoped(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	clauses := append(
+		[]sql.Clause{c.table.C[key].Equals(cleanPK), c.softDelete.deleted()},
+		scopeClauses(c.table, scope)...,
+	)
+
+	// Get the deleted entry for preconditions and the update hooks
+	old := c.entry(r.Tx, sql.AllOf(clauses...))
+	if old == nil {
+		return nil, MessageError(
+			404,
+			CodeNotDeleted,
+			map[string]interface{}{"key": key, "value": dirtyPK},
+		).SetErrorCode(CodeNotFound)
+	}
+	if apiErr = c.checkIfMatch(r, old); apiErr != nil {
+		return nil, apiErr
+	}
+
+	values := sql.Values{c.softDelete.column.Name(): c.softDelete.unmark()}
+	if apiErr = runUpdateHooks(c.hooks.beforeUpdate, r, old, values); apiErr != nil {
+		return nil, apiErr
+	}
+
+	stmt := c.table.Update().Values(values).Where(sql.AllOf(clauses...))
+	if _, err = r.Tx.Execute(stmt); err != nil {
+		if apiErr = constraintError(err); apiErr != nil {
+			return nil, apiErr
+		}
+		panic(fmt.Sprintf(
+			"argo: could not execute sql resource restore (%s): %s",
+			stmt,
+			err,
+		))
+	}
+
+	// Send the restored resource back
+	selectStmt := sql.Select(c.readable(r)).Where(c.table.C[key].Equals(cleanPK))
+	result := sql.Values{}
+	if dbErr := r.Tx.QueryOne(selectStmt, result); dbErr != nil {
+		panic(fmt.Sprintf(
+			"argo: could not query one in sql resource restore (%s): %s",
+			selectStmt,
+			dbErr,
+		))
+	}
+	FixValues(result)
+	c.includeDetail(r, r.Tx, result)
+	setETag(r, c.etag(result))
+
+	if apiErr = runUpdateHooks(c.hooks.afterUpdate, r, old, result); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr = runHooks(c.hooks.afterRead, r, result); apiErr != nil {
+		return nil, apiErr
+	}
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package argo
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/aodin/aspect/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var notesDB = sql.Table("notes",
+	sql.Column("id", postgres.Serial{}),
+	sql.Column("text", sql.String{NotNull: true}),
+	sql.Column("deleted_at", sql.Timestamp{}),
+	sql.PrimaryKey("id"),
+)
+
+func TestSoftDelete(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, notesDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	notes := Resource(
+		FromTable(notesDB),
+		SoftDelete("deleted_at").AllowIncludeDeleted(
+			func(r *Request) bool { return true },
+		),
+	)
+	notes.conn = tx
+
+	response, errAPI := notes.Post(MockRequest([]byte(`{"text":"hi"}`), nil))
+	require.Nil(t, errAPI)
+	id := response.(sql.Values)["id"].(int64)
+
+	// The soft delete column is read-only
+	_, errAPI = notes.Patch(MockRequest([]byte(`{"deleted_at":null}`), nil, id))
+	require.NotNil(t, errAPI)
+	assert.NotNil(errAPI.Fields["deleted_at"])
+
+	_, errAPI = notes.Delete(MockRequest(nil, nil, id))
+	require.Nil(t, errAPI)
+
+	// Deleted entries are hidden
+	_, errAPI = notes.Get(MockRequest(nil, nil, id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+
+	_, errAPI = notes.Delete(MockRequest(nil, nil, id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+
+	response, errAPI = notes.List(MockRequest(nil, nil))
+	require.Nil(t, errAPI)
+	assert.Equal(0, len(response.(MultiResponse).Results.([]sql.Values)))
+
+	// Unless they are requested
+	included := url.Values{"include_deleted": []string{"true"}}
+	response, errAPI = notes.List(MockRequest(nil, included))
+	require.Nil(t, errAPI)
+	assert.Equal(1, len(response.(MultiResponse).Results.([]sql.Values)))
+
+	_, errAPI = notes.Get(MockRequest(nil, included, id))
+	assert.Nil(errAPI)
+
+	// Restores check the precondition of the deleted entry
+	actions := notes.Actions()
+	require.Equal(t, 1, len(actions))
+	assert.Equal("restore", actions[0].Name)
+	stale := MockRequest(nil, nil, id)
+	stale.Header = http.Header{"If-Match": []string{`"stale"`}}
+	_, errAPI = actions[0].Handler(stale)
+	require.NotNil(t, errAPI)
+	assert.Equal(412, errAPI.code)
+
+	// Restore the entry
+	_, errAPI = actions[0].Handler(MockRequest(nil, nil, id))
+	require.Nil(t, errAPI)
+
+	_, errAPI = notes.Get(MockRequest(nil, nil, id))
+	assert.Nil(errAPI)
+
+	// Only deleted entries can be restored
+	_, errAPI = actions[0].Handler(MockRequest(nil, nil, id))
+	require.NotNil(t, errAPI)
+	assert.Equal(404, errAPI.code)
+}
+
+func TestSoftDelete_RestoreHooks(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, notesDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	var before, after sql.Values
+	notes := Resource(
+		FromTable(notesDB),
+		SoftDelete("deleted_at"),
+		BeforeUpdate(func(r *Request, old, values sql.Values) *APIError {
+			before = values
+			return nil
+		}),
+		AfterUpdate(func(r *Request, old, values sql.Values) *APIError {
+			after = values
+			return nil
+		}),
+	)
+	notes.conn = tx
+
+	response, errAPI := notes.Post(MockRequest([]byte(`{"text":"hi"}`), nil))
+	require.Nil(t, errAPI)
+	id := response.(sql.Values)["id"].(int64)
+	_, errAPI = notes.Delete(MockRequest(nil, nil, id))
+	require.Nil(t, errAPI)
+
+	// Restores run the update hooks with the soft delete column
+	_, errAPI = notes.restore(MockRequest(nil, nil, id))
+	require.Nil(t, errAPI)
+	assert.Equal(sql.Values{"deleted_at": nil}, before)
+	assert.Equal("hi", after["text"])
+}
+
+func TestSoftDelete_IncludeDeleted(t *testing.T) {
+	assert := assert.New(t)
+
+	notes := Resource(
+		FromTable(notesDB),
+		SoftDelete("deleted_at").AllowIncludeDeleted(
+			func(r *Request) bool { return true },
+		),
+	)
+
+	// Parsing the meta of a list must not remove the parameter
+	r := MockRequest(nil, url.Values{
+		"include_deleted": []string{"true"},
+		"limit":           []string{"5"},
+	})
+	meta := notes.parseMeta(r)
+	assert.Equal(5, meta.Limit)
+	assert.True(notes.includeDeleted(r))
+
+	assert.False(notes.includeDeleted(MockRequest(nil, nil)))
+}
+
+func TestSoftDelete_AuthorizeRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	notes := Resource(
+		FromTable(notesDB),
+		SoftDelete("deleted_at"),
+		Authorize(DELETE, AllowRoles("admin")),
+	)
+
+	// Restores are rejected before the database is queried
+	r := MockRequest(nil, nil, 1)
+	r.Principal = &Principal{ID: "user"}
+	_, errAPI := notes.restore(r)
+	require.NotNil(t, errAPI)
+	assert.Equal(403, errAPI.code)
+}
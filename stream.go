@@ -0,0 +1,115 @@
+package argo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	sql "github.com/aodin/aspect"
+)
+
+// StreamEncoder is implemented by encoders that can write responses as
+// they are produced, instead of returning them as a single payload.
+// Responses to requests with other encoders are buffered and encoded with
+// Encode.
+type StreamEncoder interface {
+	Encoder
+	EncodeTo(w io.Writer, i interface{}) error
+}
+
+// StreamResponse is a page of a list whose results are written as they
+// are scanned from the database. It is returned by the List method of
+// resources with the Stream modifier when the request encoder implements
+// StreamEncoder.
+type StreamResponse struct {
+	Meta   Meta
+	Fields []string
+	Rows   Rows
+	close  func() error // Releases what the stream holds, such as a subscription
+}
+
+// Close releases the resources of the stream
+func (stream StreamResponse) Close() error {
+	if stream.close == nil {
+		return nil
+	}
+	return stream.close()
+}
+
+// buffer reads every row of the stream into a MultiResponse
+func (stream StreamResponse) buffer() (MultiResponse, error) {
+	results := make([]sql.Values, 0)
+	for {
+		row, err := stream.Rows.Next()
+		if err != nil {
+			return MultiResponse{}, err
+		}
+		if row == nil {
+			break
+		}
+		results = append(results, row)
+	}
+	return MultiResponse{
+		Meta:    stream.Meta,
+		Results: results,
+		fields:  stream.Fields,
+	}, nil
+}
+
+// Stream returns a Modifier that writes the results of lists as they are
+// scanned from the database. Streamed lists are not tagged for caching,
+// since their representation is unknown until it has been written.
+func Stream() Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		resource.stream = true
+		return nil
+	})
+}
+
+// flushWriter flushes every write, so that clients receive the rows of a
+// stream as soon as they are encoded
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if flusher, ok := fw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// streamList streams the page of the list
+func (c *ResourceSQL) streamList(r *Request, meta Meta, filters []sql.Clause) (Response, *APIError) {
+	fields := c.fieldOrder(r)
+	return StreamResponse{
+		Meta:   meta,
+		Fields: c.rowFields(r, fields),
+		Rows:   c.cursor(r, fields, meta, filters, meta.Offset, meta.Limit),
+	}, nil
+}
+
+// writeStream writes the stream with the encoder of the request. Errors
+// before the headers are written are written as any other error of the
+// API.
+func (api *API) writeStream(w http.ResponseWriter, request *Request, stream StreamResponse) {
+	defer stream.Close()
+	streamer, ok := request.Encoding.(StreamEncoder)
+	if !ok {
+		response, err := stream.buffer()
+		if err != nil {
+			if apiErr, ok := err.(*APIError); ok {
+				api.writeError(w, request, apiErr)
+				return
+			}
+			panic(fmt.Sprintf("argo: could not read stream: %s", err))
+		}
+		w.Header().Set("Content-Type", request.Encoding.MediaType())
+		w.Write(request.Encoding.Encode(response))
+		return
+	}
+	w.Header().Set("Content-Type", request.Encoding.MediaType())
+	// Headers have been written, so errors can only end the stream
+	streamer.EncodeTo(flushWriter{w: w}, stream)
+}
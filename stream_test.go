@@ -0,0 +1,131 @@
+package argo
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON_EncodeTo(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := StreamResponse{
+		Meta:   Meta{Limit: 2},
+		Fields: []string{"id"},
+		Rows: &valuesRows{
+			rows: []sql.Values{{"id": int64(1)}, {"id": int64(2)}},
+		},
+	}
+	var buffer bytes.Buffer
+	require.Nil(t, JSON{}.EncodeTo(&buffer, stream))
+	assert.Equal(
+		`{"meta":{"limit":2,"offset":0},"results":[{"id":1},{"id":2}]}`,
+		buffer.String(),
+	)
+
+	buffer.Reset()
+	stream.Rows = &valuesRows{}
+	require.Nil(t, JSON{}.EncodeTo(&buffer, stream))
+	assert.Equal(
+		`{"meta":{"limit":2,"offset":0},"results":[]}`,
+		buffer.String(),
+	)
+
+	// Other responses are encoded as usual
+	buffer.Reset()
+	require.Nil(t, JSON{}.EncodeTo(&buffer, sql.Values{"id": 1}))
+	assert.Equal(string(JSON{}.Encode(sql.Values{"id": 1})), buffer.String())
+}
+
+func TestWriteStream(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := func() StreamResponse {
+		return StreamResponse{
+			Meta:   Meta{Limit: 1},
+			Fields: []string{"id"},
+			Rows:   &valuesRows{rows: []sql.Values{{"id": int64(1)}}},
+		}
+	}
+
+	w := httptest.NewRecorder()
+	New().writeStream(w, &Request{Encoding: CSV{}}, stream())
+	assert.Equal("text/csv", w.Header().Get("Content-Type"))
+	assert.Equal("id\r\n1\r\n", w.Body.String())
+	assert.Equal(true, w.Flushed)
+
+	// Encoders that cannot stream receive the buffered response
+	w = httptest.NewRecorder()
+	New().writeStream(w, &Request{Encoding: YAML{}}, stream())
+	assert.Equal("application/x-yaml", w.Header().Get("Content-Type"))
+	buffered, err := stream().buffer()
+	require.Nil(t, err)
+	assert.Equal(string(YAML{}.Encode(buffered)), w.Body.String())
+
+	// Errors before the headers are written are errors of the API
+	failing := StreamResponse{Rows: failingRows{}}
+	w = httptest.NewRecorder()
+	request := &Request{
+		Request:  &http.Request{URL: &url.URL{Path: "/users"}, Header: http.Header{}},
+		Encoding: YAML{},
+	}
+	New().ProblemDetails("").writeStream(w, request, failing)
+	assert.Equal(403, w.Code)
+	assert.Equal(ProblemMediaType, w.Header().Get("Content-Type"))
+}
+
+// failingRows fails on its first row
+type failingRows struct{}
+
+func (failingRows) Next() (sql.Values, error) {
+	return nil, MessageError(403, CodeForbidden, nil)
+}
+
+func TestResource_Stream(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(FromTable(usersDB), WriteOnly("password"), Stream())
+	users.conn = tx
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, errAPI := users.Post(MockRequest(
+			[]byte(`{"name":"`+name+`","age":1,"password":"x"}`), nil,
+		))
+		require.Nil(t, errAPI)
+	}
+
+	r := MockRequest(nil, url.Values{
+		"limit": []string{"2"},
+		"order": []string{"name"},
+	})
+	r.Encoding = JSON{}
+	response, errAPI := users.List(r)
+	require.Nil(t, errAPI)
+	stream := response.(StreamResponse)
+	defer stream.Close()
+	assert.Equal(2, stream.Meta.Limit)
+
+	buffered, err := stream.buffer()
+	require.Nil(t, err)
+	results := buffered.Results.([]sql.Values)
+	require.Equal(t, 2, len(results))
+	assert.Equal("a", results[0]["name"])
+	assert.Equal("b", results[1]["name"])
+
+	// Requests with other encoders are not streamed
+	r = MockRequest(nil, nil)
+	r.Encoding = YAML{}
+	response, errAPI = users.List(r)
+	require.Nil(t, errAPI)
+	_, ok := response.(MultiResponse)
+	assert.Equal(true, ok)
+}
@@ -0,0 +1,157 @@
+package argo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sql "github.com/aodin/aspect"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer converts a string value into its normal form
+type Normalizer func(string) string
+
+// UniqueElem is the internal representation of a uniqueness rule that is
+// checked before entries are written. By default a rule is created for each
+// unique constraint of the resource table, using strict equality.
+type UniqueElem struct {
+	columns     []string
+	normalizers []Normalizer
+	fold        bool // Compare case-insensitively
+	store       bool // Write normalized values to the database
+}
+
+// Fold compares values case-insensitively
+func (elem UniqueElem) Fold() UniqueElem {
+	elem.fold = true
+	elem.normalizers = append(elem.copyNormalizers(), strings.ToLower)
+	return elem
+}
+
+// TrimSpace removes leading and trailing whitespace from values
+func (elem UniqueElem) TrimSpace() UniqueElem {
+	elem.normalizers = append(elem.copyNormalizers(), strings.TrimSpace)
+	return elem
+}
+
+// NFKC converts values to Unicode Normalization Form KC, so that
+// compatible characters, such as full-width letters, are equal
+func (elem UniqueElem) NFKC() UniqueElem {
+	elem.normalizers = append(elem.copyNormalizers(), norm.NFKC.String)
+	return elem
+}
+
+// NormalizeWith adds a custom normalizer. Normalizers are applied in the
+// order they were added.
+func (elem UniqueElem) NormalizeWith(normalizer Normalizer) UniqueElem {
+	elem.normalizers = append(elem.copyNormalizers(), normalizer)
+	return elem
+}
+
+// Store writes the normalized values to the database instead of the values
+// given by the client. Without it, only the lookup is normalized, and
+// whitespace and Unicode normalization will only match entries that were
+// stored in normal form.
+func (elem UniqueElem) Store() UniqueElem {
+	elem.store = true
+	return elem
+}
+
+// copyNormalizers prevents copies of the element from sharing normalizers
+func (elem UniqueElem) copyNormalizers() []Normalizer {
+	normalizers := make([]Normalizer, len(elem.normalizers))
+	copy(normalizers, elem.normalizers)
+	return normalizers
+}
+
+// normalize returns the normal form of the given value. Only strings are
+// normalized.
+func (elem UniqueElem) normalize(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	for _, normalizer := range elem.normalizers {
+		str = normalizer(str)
+	}
+	return str
+}
+
+// clause returns the lookup clause for a value of the given column
+func (elem UniqueElem) clause(column sql.ColumnElem, value interface{}) sql.Clause {
+	normal := elem.normalize(value)
+	if str, ok := normal.(string); ok && elem.fold {
+		return column.ILike(escapeLike(str))
+	}
+	return column.Equals(normal)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// Modify implements the Modifier interface. It replaces the uniqueness rule
+// for the same set of columns, or adds a new rule if the table has no
+// such unique constraint.
+func (elem UniqueElem) Modify(resource *ResourceSQL) error {
+	for _, name := range elem.columns {
+		if _, exists := resource.table.C[name]; !exists {
+			return fmt.Errorf(
+				"argo: cannot make '%s' unique, table '%s' does not have a column with this name",
+				name,
+				resource.table.Name,
+			)
+		}
+	}
+	for i, unique := range resource.uniques {
+		if sameColumns(unique.columns, elem.columns) {
+			resource.uniques[i] = elem
+			return nil
+		}
+	}
+	resource.uniques = append(resource.uniques, elem)
+	return nil
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Unique creates a new uniqueness rule for the given columns. It can be
+// used to normalize an existing unique constraint of the table, or to
+// check the uniqueness of columns without a database constraint.
+func Unique(columns ...string) UniqueElem {
+	if len(columns) == 0 {
+		panic("argo: unique statements must have at least one column")
+	}
+	return UniqueElem{columns: columns}
+}
+
+// normalizeValues replaces the values of columns with stored uniqueness
+// rules by their normal form.
+func (c *ResourceSQL) normalizeValues(values sql.Values) {
+	for _, unique := range c.uniques {
+		if !unique.store {
+			continue
+		}
+		for _, name := range unique.columns {
+			if value, exists := values[name]; exists {
+				values[name] = unique.normalize(value)
+			}
+		}
+	}
+}
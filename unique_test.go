@@ -0,0 +1,55 @@
+package argo
+
+import (
+	"testing"
+
+	sql "github.com/aodin/aspect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniqueElem(t *testing.T) {
+	assert := assert.New(t)
+
+	elem := Unique("name").TrimSpace().NFKC().Fold()
+	assert.Equal("admin", elem.normalize("  ＡＤＭＩＮ "))
+	assert.Equal(int64(1), elem.normalize(int64(1)))
+
+	// Copies do not share normalizers
+	base := Unique("name").TrimSpace()
+	folded := base.Fold()
+	assert.Equal(1, len(base.normalizers))
+	assert.Equal(2, len(folded.normalizers))
+
+	assert.Equal(`100\%\_\\`, escapeLike(`100%_\`))
+
+	assert.Equal(true, sameColumns([]string{"a", "b"}, []string{"b", "a"}))
+	assert.Equal(false, sameColumns([]string{"a"}, []string{"a", "b"}))
+}
+
+func TestResource_NormalizedUnique(t *testing.T) {
+	assert := assert.New(t)
+	conn, tx := initSchemas(t, usersDB)
+	defer tx.Rollback()
+	defer conn.Close()
+
+	users := Resource(
+		FromTable(usersDB),
+		Unique("name").TrimSpace().Fold().Store(),
+	)
+	users.conn = tx
+
+	response, errAPI := users.Post(MockRequest(
+		[]byte(`{"name":" Admin ","age":1,"password":"secret"}`), nil,
+	))
+	require.Nil(t, errAPI)
+	assert.Equal("admin", response.(sql.Values)["name"])
+
+	_, errAPI = users.Post(MockRequest(
+		[]byte(`{"name":"ADMIN","age":1,"password":"secret"}`), nil,
+	))
+	require.NotNil(t, errAPI)
+	assert.Equal(400, errAPI.code)
+	assert.Equal(CodeDuplicate, errAPI.ErrorCode())
+	assert.NotNil(errAPI.Fields["name"])
+}
@@ -1,7 +1,23 @@
 package argo
 
 import (
+	"fmt"
+	"unicode/utf8"
+
 	sql "github.com/aodin/aspect"
+	"github.com/aodin/aspect/postgres"
+)
+
+// Column types fail with the following codes, or with CodeInvalidType
+// and CodeTooLong for strings. Their other errors keep the message of
+// the type as CodeInvalidValue.
+const (
+	CodeNotNull      = "not_null"
+	CodeNotInteger   = "not_integer"
+	CodeNotNumber    = "not_number"
+	CodeNotBoolean   = "not_boolean"
+	CodeNotTimestamp = "not_timestamp"
+	CodeNotDate      = "not_date"
 )
 
 type Validator interface {
@@ -22,3 +38,188 @@ func (opt OptionalType) IsRequired() bool {
 func MakeOptional(t sql.Type) OptionalType {
 	return OptionalType{Type: t}
 }
+
+// RequiredType wraps a database field. It keeps the type's underlying
+// validation while marking it as required.
+type RequiredType struct {
+	sql.Type
+}
+
+func (req RequiredType) IsRequired() bool {
+	return true
+}
+
+func MakeRequired(t sql.Type) RequiredType {
+	return RequiredType{Type: t}
+}
+
+// ValidatorFunc allows an ordinary function to be used as a Validator.
+// It never makes a field required.
+type ValidatorFunc func(interface{}) (interface{}, error)
+
+func (f ValidatorFunc) IsRequired() bool {
+	return false
+}
+
+func (f ValidatorFunc) Validate(value interface{}) (interface{}, error) {
+	return f(value)
+}
+
+// Validators composes multiple validators. Values are cleaned by each
+// validator in order. The composed field is required if any of its
+// validators is required.
+//
+// Validators that fail with a FieldError or FieldErrors do not stop the
+// validators after them, so that every problem with a value is reported
+// at once. Any other error, such as those of column types, stops them.
+type Validators []Validator
+
+func (vs Validators) IsRequired() bool {
+	for _, v := range vs {
+		if v.IsRequired() {
+			return true
+		}
+	}
+	return false
+}
+
+func (vs Validators) Validate(value interface{}) (interface{}, error) {
+	var errs FieldErrors
+	for _, v := range vs {
+		clean, err := v.Validate(value)
+		switch e := err.(type) {
+		case nil:
+			value = clean
+		case FieldError:
+			errs = append(errs, e)
+		case FieldErrors:
+			errs = append(errs, e...)
+		default:
+			if len(errs) == 0 {
+				return nil, err
+			}
+			return nil, append(errs, fieldErrors(err)...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return value, nil
+}
+
+// fieldValidators returns the validators of the given writable field,
+// starting with its column type.
+func (c *ResourceSQL) fieldValidators(name string) (Validators, error) {
+	column, exists := c.inserts[name]
+	if !exists {
+		return nil, fmt.Errorf(
+			"argo: cannot validate '%s', it is not a writable field of '%s'",
+			name,
+			c.Name,
+		)
+	}
+	if vs, ok := c.fields[name].(Validators); ok {
+		return vs, nil
+	}
+	return Validators{column.Type()}, nil
+}
+
+// typeError returns the field error of a value that the column type
+// rejected. The errors of aspect types are plain messages, so the failure
+// is inferred from the type and the value.
+func typeError(t sql.Type, value interface{}, err error) FieldError {
+	if value == nil {
+		return Message(CodeNotNull, nil)
+	}
+	switch t := t.(type) {
+	case sql.String:
+		str, ok := value.(string)
+		if !ok {
+			return errNotString
+		}
+		if t.Length > 0 && utf8.RuneCountInString(str) > t.Length {
+			return Message(CodeTooLong, map[string]interface{}{"max": t.Length})
+		}
+	case sql.Text:
+		if _, ok := value.(string); !ok {
+			return errNotString
+		}
+	case sql.Integer, postgres.Serial:
+		return Message(CodeNotInteger, nil)
+	case sql.Real, sql.Double:
+		return Message(CodeNotNumber, nil)
+	case sql.Boolean:
+		return Message(CodeNotBoolean, nil)
+	case sql.Timestamp:
+		return Message(CodeNotTimestamp, nil)
+	case sql.Date:
+		return Message(CodeNotDate, nil)
+	}
+	return Message(CodeInvalidValue, map[string]interface{}{"reason": err.Error()})
+}
+
+// typeErrors converts the error of a validator into field errors, coding
+// the errors that the type would also raise for the value
+func typeErrors(t sql.Type, value interface{}, err error) []FieldError {
+	switch err.(type) {
+	case FieldError, FieldErrors:
+		return fieldErrors(err)
+	}
+	if _, typeErr := t.Validate(value); typeErr != nil {
+		return []FieldError{typeError(t, value, typeErr)}
+	}
+	return fieldErrors(err)
+}
+
+// validator returns the Validator used for the given column
+func (c *ResourceSQL) validator(column sql.ColumnElem) Validator {
+	if v, exists := c.fields[column.Name()]; exists {
+		return v
+	}
+	return column.Type()
+}
+
+// ValidateWith returns a Modifier that adds the given validators to a field.
+// They are run after the validation of the field's column type.
+func ValidateWith(name string, validators ...Validator) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		vs, err := resource.fieldValidators(name)
+		if err != nil {
+			return err
+		}
+		resource.fields[name] = append(vs, validators...)
+		return nil
+	})
+}
+
+// Optional returns a Modifier that makes the given fields optional even if
+// their column type requires them.
+func Optional(names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			vs, err := resource.fieldValidators(name)
+			if err != nil {
+				return err
+			}
+			vs[0] = MakeOptional(resource.inserts[name].Type())
+			resource.fields[name] = vs
+		}
+		return nil
+	})
+}
+
+// Required returns a Modifier that makes the given fields required even if
+// their column type does not.
+func Required(names ...string) Modifier {
+	return ModifierFunc(func(resource *ResourceSQL) error {
+		for _, name := range names {
+			vs, err := resource.fieldValidators(name)
+			if err != nil {
+				return err
+			}
+			vs[0] = MakeRequired(resource.inserts[name].Type())
+			resource.fields[name] = vs
+		}
+		return nil
+	})
+}
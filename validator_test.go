@@ -1,10 +1,13 @@
 package argo
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	sql "github.com/aodin/aspect"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var counterDB = sql.Table("counter",
@@ -28,3 +31,123 @@ func TestMakeOptional(t *testing.T) {
 	_, err = opt.Validate("nope")
 	assert.NotNil(err)
 }
+
+func TestMakeRequired(t *testing.T) {
+	assert := assert.New(t)
+
+	typ := sql.Integer{}
+	assert.Equal(false, typ.IsRequired())
+	assert.Equal(true, MakeRequired(typ).IsRequired())
+}
+
+func TestValidators(t *testing.T) {
+	assert := assert.New(t)
+
+	// Composed validators are required if any validator is required
+	vs := Validators{counterDB.C["id"].Type(), Range(1, 10)}
+	assert.Equal(true, vs.IsRequired())
+	assert.Equal(false, Validators{Range(1, 10)}.IsRequired())
+
+	value, err := vs.Validate(int64(5))
+	assert.Nil(err)
+	assert.Equal(int64(5), value)
+
+	// Validation stops at the first failure of the column type
+	_, err = vs.Validate("nope")
+	assert.NotNil(err)
+	_, err = vs.Validate(int64(11))
+	assert.NotNil(err)
+
+	// Every field error is reported
+	password := Validators{sql.String{}, Length(8, 0), Regex(`[0-9]`)}
+	_, err = password.Validate("short")
+	require.NotNil(t, err)
+	errs := fieldErrors(err)
+	require.Equal(t, 2, len(errs))
+	assert.Equal(CodeTooShort, errs[0].Code)
+	assert.Equal(8, errs[0].Params["min"])
+	assert.Equal(CodePattern, errs[1].Code)
+	assert.Equal(
+		"must be at least 8 characters; must match the pattern [0-9]",
+		err.Error(),
+	)
+}
+
+func TestAPIError_Fields(t *testing.T) {
+	assert := assert.New(t)
+
+	apiErr := NewError(400)
+	apiErr.SetField("password", "is too short")
+	apiErr.SetField("password", "needs a digit")
+	assert.Equal(2, len(apiErr.FieldErrors["password"]))
+	assert.Equal(CodeInvalidField, apiErr.FieldErrors["password"][0].Code)
+	assert.Equal("is too short; needs a digit", apiErr.Field("password"))
+	assert.Equal("", apiErr.Field("name"))
+
+	// Errors of included entries are nested under their path
+	included := MetaError(409, "conflict")
+	included.SetField("key", "already exists")
+	apiErr.Nest(FieldPath("contacts", 0), included)
+	assert.Equal(CodeConflict, apiErr.FieldErrors["contacts.0"][0].Code)
+	assert.Equal("already exists", apiErr.Field("contacts.0.key"))
+
+	// The original shape joins the messages of each field
+	legacy := NewError(400)
+	legacy.SetField("password", "is too short")
+	legacy.SetField("password", "needs a digit")
+	b, err := json.Marshal(legacy)
+	require.Nil(t, err)
+	assert.Equal(
+		`{"meta":[],"fields":{"password":"is too short; needs a digit"}}`,
+		string(b),
+	)
+	assert.Equal(
+		map[string]string{"password": "is too short; needs a digit"},
+		legacy.Fields,
+	)
+
+	// Messages set in Fields directly have the code of the error
+	legacy.Fields["name"] = "is taken"
+	assert.Equal(
+		[]FieldError{{Code: CodeInvalidRequest, Message: "is taken"}},
+		legacy.errorsOf("name"),
+	)
+	delete(legacy.Fields, "name")
+
+	legacy.structured = true
+	b, err = json.Marshal(legacy)
+	require.Nil(t, err)
+	assert.Equal(
+		`{"code":"invalid_request","meta":[],"fields":{"password":[`+
+			`{"code":"invalid_field","message":"is too short"},`+
+			`{"code":"invalid_field","message":"needs a digit"}]}}`,
+		string(b),
+	)
+}
+
+func TestTypeErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	// Errors of column types are coded by the failure of the type
+	age := usersDB.C["age"]
+	_, err := age.Type().Validate("old")
+	require.NotNil(t, err)
+	errs := typeErrors(age.Type(), "old", err)
+	assert.Equal(1, len(errs))
+	assert.Equal(CodeNotInteger, errs[0].Code)
+	assert.Equal("must be an integer", errs[0].Message)
+
+	assert.Equal(CodeNotNull, typeError(age.Type(), nil, err).Code)
+	assert.Equal(
+		Message(CodeTooLong, map[string]interface{}{"max": 3}),
+		typeError(sql.String{Length: 3}, "long", err),
+	)
+	assert.Equal(errNotString, typeError(sql.String{}, 1, err))
+
+	// Field errors and the errors of other validators are kept
+	errs = typeErrors(age.Type(), int64(1), Message(CodeTooSmall, nil))
+	assert.Equal(CodeTooSmall, errs[0].Code)
+	errs = typeErrors(age.Type(), int64(1), fmt.Errorf("is odd"))
+	assert.Equal(CodeInvalidValue, errs[0].Code)
+	assert.Equal("is odd", errs[0].Message)
+}
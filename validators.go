@@ -0,0 +1,228 @@
+package argo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+)
+
+// The following validators can be attached to fields with ValidateWith.
+// They ignore null values, which are left to the column type, and never
+// make a field required. Their errors are FieldErrors with the following
+// codes.
+const (
+	CodeInvalidType   = "invalid_type"
+	CodePattern       = "pattern"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeTooSmall      = "too_small"
+	CodeTooLarge      = "too_large"
+	CodeInvalidChoice = "invalid_choice"
+	CodeInvalidEmail  = "invalid_email"
+	CodeInvalidURL    = "invalid_url"
+)
+
+// errNotString is the error of validators of strings
+var errNotString = Message(
+	CodeInvalidType, map[string]interface{}{"type": "string"},
+)
+
+type regexValidator struct {
+	pattern *regexp.Regexp
+}
+
+func (v regexValidator) IsRequired() bool {
+	return false
+}
+
+func (v regexValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, errNotString
+	}
+	if !v.pattern.MatchString(str) {
+		return nil, Message(
+			CodePattern,
+			map[string]interface{}{"pattern": v.pattern.String()},
+		)
+	}
+	return value, nil
+}
+
+// Regex validates that string values match the given regular expression.
+// It panics if the expression cannot be compiled.
+func Regex(expr string) Validator {
+	return regexValidator{pattern: regexp.MustCompile(expr)}
+}
+
+type lengthValidator struct {
+	min, max int
+}
+
+func (v lengthValidator) IsRequired() bool {
+	return false
+}
+
+func (v lengthValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, errNotString
+	}
+	length := utf8.RuneCountInString(str)
+	if length < v.min {
+		return nil, Message(CodeTooShort, map[string]interface{}{"min": v.min})
+	}
+	if v.max > 0 && length > v.max {
+		return nil, Message(CodeTooLong, map[string]interface{}{"max": v.max})
+	}
+	return value, nil
+}
+
+// Length validates the number of characters in string values. A max of
+// zero means there is no maximum length.
+func Length(min, max int) Validator {
+	return lengthValidator{min: min, max: max}
+}
+
+type rangeValidator struct {
+	min, max float64
+}
+
+func (v rangeValidator) IsRequired() bool {
+	return false
+}
+
+func (v rangeValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	number, ok := toFloat(value)
+	if !ok {
+		return nil, Message(
+			CodeInvalidType, map[string]interface{}{"type": "number"},
+		)
+	}
+	if number < v.min {
+		return nil, Message(CodeTooSmall, map[string]interface{}{"min": v.min})
+	}
+	if number > v.max {
+		return nil, Message(CodeTooLarge, map[string]interface{}{"max": v.max})
+	}
+	return value, nil
+}
+
+// Range validates that numeric values are between min and max, inclusive.
+func Range(min, max float64) Validator {
+	return rangeValidator{min: min, max: max}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type enumValidator struct {
+	choices []interface{}
+}
+
+func (v enumValidator) IsRequired() bool {
+	return false
+}
+
+func (v enumValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	// Compare string forms, since numbers may have been cleaned to any
+	// numeric type
+	for _, choice := range v.choices {
+		if fmt.Sprint(choice) == fmt.Sprint(value) {
+			return value, nil
+		}
+	}
+	return nil, Message(
+		CodeInvalidChoice,
+		map[string]interface{}{"choices": v.choices},
+	)
+}
+
+// Enum validates that values are one of the given choices.
+func Enum(choices ...interface{}) Validator {
+	return enumValidator{choices: choices}
+}
+
+type emailValidator struct{}
+
+func (v emailValidator) IsRequired() bool {
+	return false
+}
+
+func (v emailValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, errNotString
+	}
+	// Names such as "Admin <admin@example.com>" are not allowed
+	address, err := mail.ParseAddress(str)
+	if err != nil || address.Address != str {
+		return nil, Message(CodeInvalidEmail, nil)
+	}
+	return value, nil
+}
+
+// Email validates that string values are bare email addresses.
+func Email() Validator {
+	return emailValidator{}
+}
+
+type urlValidator struct{}
+
+func (v urlValidator) IsRequired() bool {
+	return false
+}
+
+func (v urlValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, errNotString
+	}
+	u, err := url.ParseRequestURI(str)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, Message(CodeInvalidURL, nil)
+	}
+	return value, nil
+}
+
+// URL validates that string values are absolute http or https URLs.
+func URL() Validator {
+	return urlValidator{}
+}
@@ -0,0 +1,66 @@
+package argo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinValidators(t *testing.T) {
+	assert := assert.New(t)
+
+	var err error
+	tests := []struct {
+		validator Validator
+		valid     []interface{}
+		invalid   []interface{}
+	}{
+		{
+			Regex(`^[a-z]+$`),
+			[]interface{}{"abc", nil},
+			[]interface{}{"ABC", "", 1},
+		},
+		{
+			Length(2, 4),
+			[]interface{}{"ab", "日本語", nil},
+			[]interface{}{"a", "abcde", 1},
+		},
+		{
+			Length(2, 0),
+			[]interface{}{"abcdefghijklmnop"},
+			[]interface{}{"a"},
+		},
+		{
+			Range(0, 1.5),
+			[]interface{}{0, int64(1), 1.5, nil},
+			[]interface{}{-1, 2.0, "1"},
+		},
+		{
+			Enum("a", 2),
+			[]interface{}{"a", int64(2), 2.0, nil},
+			[]interface{}{"b", 3},
+		},
+		{
+			Email(),
+			[]interface{}{"admin@example.com", nil},
+			[]interface{}{"admin", "Admin <admin@example.com>", 1},
+		},
+		{
+			URL(),
+			[]interface{}{"https://example.com/path?q=1", nil},
+			[]interface{}{"example.com", "ftp://example.com", "/path", 1},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(false, test.validator.IsRequired())
+		for _, value := range test.valid {
+			_, err = test.validator.Validate(value)
+			assert.Nil(err, "%T should accept %v", test.validator, value)
+		}
+		for _, value := range test.invalid {
+			_, err = test.validator.Validate(value)
+			assert.NotNil(err, "%T should reject %v", test.validator, value)
+		}
+	}
+}
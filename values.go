@@ -20,10 +20,10 @@ func FixValues(results ...sql.Values) {
 // HasRequired confirms that all requested keys exist in the given values map.
 func HasRequired(values sql.Values, keys ...string) *APIError {
 	// TODO use an existing error scaffold?
-	err := NewError(400)
+	err := NewError(400).SetErrorCode(CodeMissingField)
 	for _, key := range keys {
 		if _, exists := values[key]; !exists {
-			err.SetField(key, "is required")
+			err.AddField(key, Message(CodeMissingField, nil))
 		}
 	}
 	if err.Exists() {
@@ -34,7 +34,7 @@ func HasRequired(values sql.Values, keys ...string) *APIError {
 
 func ValidateUsing(values sql.Values, types map[string]Validator) *APIError {
 	// Create an empty error scaffold
-	err := NewError(400)
+	err := NewError(400).SetErrorCode(CodeInvalidField)
 
 	// Are all the required values present?
 	// for key, validator := range types {
@@ -50,12 +50,16 @@ func ValidateUsing(values sql.Values, types map[string]Validator) *APIError {
 		t, exists := types[key]
 		// Extra fields will produce an error
 		if !exists {
-			err.SetField(key, "does not exist in this resource")
+			err.AddField(key, Message(CodeUnknownField, nil))
 			continue
 		}
 		clean, validateErr := t.Validate(value)
 		if validateErr != nil {
-			err.SetField(key, validateErr.Error())
+			if typ, ok := t.(sql.Type); ok {
+				err.AddField(key, typeErrors(typ, value, validateErr)...)
+			} else {
+				err.AddField(key, fieldErrors(validateErr)...)
+			}
 			continue
 		}
 		values[key] = clean